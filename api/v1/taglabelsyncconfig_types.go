@@ -0,0 +1,169 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TagLabelSyncConfigSpec defines how ARM tags and node labels are synced for the nodes it selects
+type TagLabelSyncConfigSpec struct {
+	// NodeSelector selects the nodes this policy applies to. A policy without a selector applies to every node.
+	// +optional
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+
+	// Priority decides which policy applies to a node selected by more than one. The highest priority
+	// wins, and policies with the same priority are ordered by name.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// SyncDirection is the direction tags and labels are copied in.
+	// +kubebuilder:validation:Enum=arm-to-node;node-to-arm;two-way
+	// +optional
+	SyncDirection string `json:"syncDirection,omitempty"`
+
+	// ConflictPolicy decides what happens when a tag and label have the same name but different values.
+	// +kubebuilder:validation:Enum=arm-precedence;node-precedence;ignore
+	// +optional
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+
+	// Interval between syncs, e.g. "10m" or "2h30m".
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// LabelPrefix is prepended to ARM tag names to make node label names. May be empty.
+	// +optional
+	LabelPrefix *string `json:"labelPrefix,omitempty"`
+
+	// TagPrefix is prepended to node label names to make ARM tag names. May be empty.
+	// +optional
+	TagPrefix *string `json:"tagPrefix,omitempty"`
+
+	// ResourceGroupFilter limits syncing to nodes in resource groups matching one of these glob patterns,
+	// compared case-insensitively. If empty, nodes in every resource group are synced.
+	// +optional
+	ResourceGroupFilter []string `json:"resourceGroupFilter,omitempty"`
+
+	// SubscriptionFilter limits syncing to nodes in subscriptions matching one of these glob patterns.
+	// If empty, nodes in every subscription are synced.
+	// +optional
+	SubscriptionFilter []string `json:"subscriptionFilter,omitempty"`
+
+	// VMSSTarget is whether nodes on scale set VMs are synced with the scale set or with their own VM.
+	// +kubebuilder:validation:Enum=scale-set;instance
+	// +optional
+	VMSSTarget string `json:"vmssTarget,omitempty"`
+
+	// InheritFrom lists other places tags are read from and applied to nodes underneath the tags of
+	// the node's own resource: "resource-group" for the resource group the node's VM or scale set is in,
+	// and "subscription". The resource's own tags win over resource group tags, which win over
+	// subscription tags. On AWS, "auto-scaling-group" reads the tags of the instance's Auto Scaling group
+	// that are marked to propagate at launch. On GCE, "network-tags" turns each of the instance's network
+	// tags into a tag named "network-tag.<tag>" with an empty value. Inherited tags are never written.
+	// +optional
+	InheritFrom []string `json:"inheritFrom,omitempty"`
+
+	// PropagateTo lists resources attached to the node's VM that the tags copied from node labels are
+	// also written to: "disks" for its managed OS and data disks, and "network-interfaces" for its
+	// network interfaces. Only applies when syncing node labels to ARM.
+	// +optional
+	PropagateTo []string `json:"propagateTo,omitempty"`
+
+	// ValuePolicy is what happens to tag values that aren't valid label values: "escape" writes invalid
+	// characters as '_' and two hex digits, "substitute" replaces them with '-', and "skip" leaves the tag off nodes.
+	// +kubebuilder:validation:Enum=escape;substitute;skip
+	// +optional
+	ValuePolicy string `json:"valuePolicy,omitempty"`
+
+	// TargetKind is whether ARM tags are copied to node labels or to node annotations. Annotations
+	// take any value, so tag values are copied unchanged.
+	// +kubebuilder:validation:Enum=label;annotation
+	// +optional
+	TargetKind string `json:"targetKind,omitempty"`
+
+	// AnnotationTags lists tag names that are copied to annotations even if TargetKind is label,
+	// as globs or regular expressions prefixed with "regex:".
+	// +optional
+	AnnotationTags []string `json:"annotationTags,omitempty"`
+
+	// AnnotationPrefix is prepended to ARM tag names to make node annotation names. May be empty.
+	// +optional
+	AnnotationPrefix *string `json:"annotationPrefix,omitempty"`
+
+	// TaintTagPrefix turns tags whose names start with it into node taints instead of labels, e.g. with
+	// "k8s-taint-", tag "k8s-taint-dedicated" with value "gpu:NoSchedule" becomes the taint
+	// "dedicated=gpu:NoSchedule". If empty, no taints are created.
+	// +optional
+	TaintTagPrefix string `json:"taintTagPrefix,omitempty"`
+
+	// TagFilter selects the ARM tags copied to nodes, by tag name.
+	// +optional
+	TagFilter *KeyFilter `json:"tagFilter,omitempty"`
+
+	// LabelFilter selects the node labels and annotations copied to ARM, by name. Labels set by Kubernetes
+	// and AKS are excluded unless exclude is set.
+	// +optional
+	LabelFilter *KeyFilter `json:"labelFilter,omitempty"`
+}
+
+// KeyFilter selects tag or label names by pattern. Patterns are globs, or regular expressions
+// prefixed with "regex:" that must match the whole name.
+type KeyFilter struct {
+	// Include lists the names that are synced. If empty, every name not excluded is synced.
+	// +optional
+	Include []string `json:"include,omitempty"`
+
+	// Exclude lists the names that are never synced, even if included.
+	// +optional
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// TagLabelSyncConfigStatus defines the observed state of TagLabelSyncConfig
+type TagLabelSyncConfigStatus struct {
+	// ObservedGeneration is the most recent generation read by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Priority",type="integer",JSONPath=".spec.priority"
+// +kubebuilder:printcolumn:name="Direction",type="string",JSONPath=".spec.syncDirection"
+// +kubebuilder:printcolumn:name="Conflict Policy",type="string",JSONPath=".spec.conflictPolicy"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// TagLabelSyncConfig is the Schema for the taglabelsyncconfigs API
+type TagLabelSyncConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TagLabelSyncConfigSpec   `json:"spec,omitempty"`
+	Status TagLabelSyncConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TagLabelSyncConfigList contains a list of TagLabelSyncConfig
+type TagLabelSyncConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TagLabelSyncConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TagLabelSyncConfig{}, &TagLabelSyncConfigList{})
+}
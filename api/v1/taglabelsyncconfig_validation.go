@@ -0,0 +1,166 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var (
+	syncDirections   = []string{"arm-to-node", "node-to-arm", "two-way"}
+	conflictPolicies = []string{"arm-precedence", "node-precedence", "ignore"}
+	vmssTargets      = []string{"scale-set", "instance"}
+	valuePolicies    = []string{"escape", "substitute", "skip"}
+	targetKinds      = []string{"label", "annotation"}
+	tagSources       = []string{"resource-group", "subscription", "auto-scaling-group", "network-tags"}
+	attachedKinds    = []string{"disks", "network-interfaces"}
+)
+
+// InvalidTagChars can't appear in ARM tag names
+const InvalidTagChars string = "<>%&\\?/"
+
+// reservedAnnotationPrefix is used by the controller's own annotations, so tags can't be copied under it
+const reservedAnnotationPrefix string = "tag-label-sync.io"
+
+// RegexPrefix marks a key filter pattern as a regular expression rather than a glob
+const RegexPrefix string = "regex:"
+
+// Validate returns every problem with the spec. Unset fields are valid, since they have defaults.
+func (s *TagLabelSyncConfigSpec) Validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if s.NodeSelector != nil {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(s.NodeSelector, fldPath.Child("nodeSelector"))...)
+	}
+	allErrs = append(allErrs, validateEnum(s.SyncDirection, syncDirections, fldPath.Child("syncDirection"))...)
+	allErrs = append(allErrs, validateEnum(s.ConflictPolicy, conflictPolicies, fldPath.Child("conflictPolicy"))...)
+	allErrs = append(allErrs, validateEnum(s.VMSSTarget, vmssTargets, fldPath.Child("vmssTarget"))...)
+	allErrs = append(allErrs, validateEnum(s.ValuePolicy, valuePolicies, fldPath.Child("valuePolicy"))...)
+	allErrs = append(allErrs, validateEnumList(s.InheritFrom, tagSources, fldPath.Child("inheritFrom"))...)
+	allErrs = append(allErrs, validateEnumList(s.PropagateTo, attachedKinds, fldPath.Child("propagateTo"))...)
+	if s.Interval != nil && s.Interval.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("interval"), s.Interval.Duration.String(), "must be greater than zero"))
+	}
+	if s.LabelPrefix != nil && *s.LabelPrefix != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(*s.LabelPrefix) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("labelPrefix"), *s.LabelPrefix, msg))
+		}
+	}
+	allErrs = append(allErrs, validateEnum(s.TargetKind, targetKinds, fldPath.Child("targetKind"))...)
+	allErrs = append(allErrs, validatePatterns(s.AnnotationTags, fldPath.Child("annotationTags"))...)
+	if s.AnnotationPrefix != nil && *s.AnnotationPrefix != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(*s.AnnotationPrefix) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("annotationPrefix"), *s.AnnotationPrefix, msg))
+		}
+		if *s.AnnotationPrefix == reservedAnnotationPrefix {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("annotationPrefix"), *s.AnnotationPrefix, "is reserved for the controller's own annotations"))
+		}
+	}
+	if strings.ContainsAny(s.TaintTagPrefix, InvalidTagChars) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("taintTagPrefix"), s.TaintTagPrefix,
+			fmt.Sprintf("must not contain any of %q", InvalidTagChars)))
+	}
+	if s.TagPrefix != nil && strings.ContainsAny(*s.TagPrefix, InvalidTagChars) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("tagPrefix"), *s.TagPrefix,
+			fmt.Sprintf("must not contain any of %q", InvalidTagChars)))
+	}
+	allErrs = append(allErrs, validateGlobs(s.ResourceGroupFilter, fldPath.Child("resourceGroupFilter"))...)
+	allErrs = append(allErrs, validateGlobs(s.SubscriptionFilter, fldPath.Child("subscriptionFilter"))...)
+	if s.TagFilter != nil {
+		allErrs = append(allErrs, s.TagFilter.Validate(fldPath.Child("tagFilter"))...)
+	}
+	if s.LabelFilter != nil {
+		allErrs = append(allErrs, s.LabelFilter.Validate(fldPath.Child("labelFilter"))...)
+	}
+
+	return allErrs
+}
+
+// Validate returns an error for each pattern that is neither a valid glob nor a valid regular expression.
+func (f *KeyFilter) Validate(fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	allErrs = append(allErrs, validatePatterns(f.Include, fldPath.Child("include"))...)
+	allErrs = append(allErrs, validatePatterns(f.Exclude, fldPath.Child("exclude"))...)
+	return allErrs
+}
+
+func validateEnum(value string, allowed []string, fldPath *field.Path) field.ErrorList {
+	if value == "" {
+		return nil
+	}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return field.ErrorList{field.NotSupported(fldPath, value, allowed)}
+}
+
+func validateEnumList(values []string, allowed []string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, value := range values {
+		if value == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Index(i), ""))
+			continue
+		}
+		allErrs = append(allErrs, validateEnum(value, allowed, fldPath.Index(i))...)
+		for _, previous := range values[:i] {
+			if value == previous {
+				allErrs = append(allErrs, field.Duplicate(fldPath.Index(i), value))
+			}
+		}
+	}
+	return allErrs
+}
+
+func validatePatterns(patterns []string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, pattern := range patterns {
+		if strings.HasPrefix(pattern, RegexPrefix) {
+			if _, err := regexp.Compile(strings.TrimPrefix(pattern, RegexPrefix)); err != nil {
+				allErrs = append(allErrs, field.Invalid(fldPath.Index(i), pattern, err.Error()))
+			}
+			continue
+		}
+		allErrs = append(allErrs, validateGlob(pattern, fldPath.Index(i))...)
+	}
+	return allErrs
+}
+
+func validateGlobs(patterns []string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, pattern := range patterns {
+		allErrs = append(allErrs, validateGlob(pattern, fldPath.Index(i))...)
+	}
+	return allErrs
+}
+
+func validateGlob(pattern string, fldPath *field.Path) field.ErrorList {
+	if pattern == "" {
+		return field.ErrorList{field.Required(fldPath, "pattern must not be empty")}
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, pattern, err.Error())}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// Defaults of the options, which the controller also applies to fields left unset.
+const (
+	DefaultSyncDirection    string        = "arm-to-node"
+	DefaultConflictPolicy   string        = "arm-precedence"
+	DefaultInterval         time.Duration = 10 * time.Hour
+	DefaultLabelPrefix      string        = "azure.tags"
+	DefaultTagPrefix        string        = "node.labels"
+	DefaultVMSSTarget       string        = "scale-set"
+	DefaultValuePolicy      string        = "substitute"
+	DefaultTargetKind       string        = "label"
+	DefaultAnnotationPrefix string        = "azure.tags"
+)
+
+// DefaultLabelExcludes keeps labels set by Kubernetes and AKS from being copied to ARM.
+var DefaultLabelExcludes = []string{
+	"kubernetes.io/*",
+	"*.kubernetes.io/*",
+	"k8s.io/*",
+	"*.k8s.io/*",
+	"kubernetes.azure.com/*",
+}
+
+func (r *TagLabelSyncConfig) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-taglabel-tag-label-sync-io-v1-taglabelsyncconfig,mutating=true,failurePolicy=fail,groups=taglabel.tag-label-sync.io,resources=taglabelsyncconfigs,verbs=create;update,versions=v1,name=mtaglabelsyncconfig.tag-label-sync.io
+
+var _ webhook.Defaulter = &TagLabelSyncConfig{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *TagLabelSyncConfig) Default() {
+	if r.Spec.SyncDirection == "" {
+		r.Spec.SyncDirection = DefaultSyncDirection
+	}
+	if r.Spec.ConflictPolicy == "" {
+		r.Spec.ConflictPolicy = DefaultConflictPolicy
+	}
+	if r.Spec.Interval == nil {
+		r.Spec.Interval = &metav1.Duration{Duration: DefaultInterval}
+	}
+	if r.Spec.LabelPrefix == nil {
+		labelPrefix := DefaultLabelPrefix
+		r.Spec.LabelPrefix = &labelPrefix
+	}
+	if r.Spec.TagPrefix == nil {
+		tagPrefix := DefaultTagPrefix
+		r.Spec.TagPrefix = &tagPrefix
+	}
+	if r.Spec.VMSSTarget == "" {
+		r.Spec.VMSSTarget = DefaultVMSSTarget
+	}
+	if r.Spec.ValuePolicy == "" {
+		r.Spec.ValuePolicy = DefaultValuePolicy
+	}
+	if r.Spec.TargetKind == "" {
+		r.Spec.TargetKind = DefaultTargetKind
+	}
+	if r.Spec.AnnotationPrefix == nil {
+		annotationPrefix := DefaultAnnotationPrefix
+		r.Spec.AnnotationPrefix = &annotationPrefix
+	}
+	if r.Spec.LabelFilter == nil {
+		r.Spec.LabelFilter = &KeyFilter{}
+	}
+	if r.Spec.LabelFilter.Exclude == nil {
+		r.Spec.LabelFilter.Exclude = append([]string(nil), DefaultLabelExcludes...)
+	}
+}
+
+// +kubebuilder:webhook:path=/validate-taglabel-tag-label-sync-io-v1-taglabelsyncconfig,mutating=false,failurePolicy=fail,groups=taglabel.tag-label-sync.io,resources=taglabelsyncconfigs,verbs=create;update,versions=v1,name=vtaglabelsyncconfig.tag-label-sync.io
+
+var _ webhook.Validator = &TagLabelSyncConfig{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *TagLabelSyncConfig) ValidateCreate() error {
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *TagLabelSyncConfig) ValidateUpdate(old runtime.Object) error {
+	return r.validate()
+}
+
+func (r *TagLabelSyncConfig) validate() error {
+	allErrs := r.Spec.Validate(field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Group: GroupVersion.Group, Kind: "TagLabelSyncConfig"}, r.Name, allErrs)
+}
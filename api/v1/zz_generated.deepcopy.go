@@ -0,0 +1,199 @@
+//go:build !ignore_autogenerated
+
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeyFilter) DeepCopyInto(out *KeyFilter) {
+	*out = *in
+	if in.Include != nil {
+		in, out := &in.Include, &out.Include
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeyFilter.
+func (in *KeyFilter) DeepCopy() *KeyFilter {
+	if in == nil {
+		return nil
+	}
+	out := new(KeyFilter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TagLabelSyncConfig) DeepCopyInto(out *TagLabelSyncConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TagLabelSyncConfig.
+func (in *TagLabelSyncConfig) DeepCopy() *TagLabelSyncConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(TagLabelSyncConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TagLabelSyncConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TagLabelSyncConfigList) DeepCopyInto(out *TagLabelSyncConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]TagLabelSyncConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TagLabelSyncConfigList.
+func (in *TagLabelSyncConfigList) DeepCopy() *TagLabelSyncConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(TagLabelSyncConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TagLabelSyncConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TagLabelSyncConfigSpec) DeepCopyInto(out *TagLabelSyncConfigSpec) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.LabelPrefix != nil {
+		in, out := &in.LabelPrefix, &out.LabelPrefix
+		*out = new(string)
+		**out = **in
+	}
+	if in.TagPrefix != nil {
+		in, out := &in.TagPrefix, &out.TagPrefix
+		*out = new(string)
+		**out = **in
+	}
+	if in.ResourceGroupFilter != nil {
+		in, out := &in.ResourceGroupFilter, &out.ResourceGroupFilter
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SubscriptionFilter != nil {
+		in, out := &in.SubscriptionFilter, &out.SubscriptionFilter
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.InheritFrom != nil {
+		in, out := &in.InheritFrom, &out.InheritFrom
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PropagateTo != nil {
+		in, out := &in.PropagateTo, &out.PropagateTo
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AnnotationTags != nil {
+		in, out := &in.AnnotationTags, &out.AnnotationTags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AnnotationPrefix != nil {
+		in, out := &in.AnnotationPrefix, &out.AnnotationPrefix
+		*out = new(string)
+		**out = **in
+	}
+	if in.TagFilter != nil {
+		in, out := &in.TagFilter, &out.TagFilter
+		*out = new(KeyFilter)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LabelFilter != nil {
+		in, out := &in.LabelFilter, &out.LabelFilter
+		*out = new(KeyFilter)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TagLabelSyncConfigSpec.
+func (in *TagLabelSyncConfigSpec) DeepCopy() *TagLabelSyncConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TagLabelSyncConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TagLabelSyncConfigStatus) DeepCopyInto(out *TagLabelSyncConfigStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TagLabelSyncConfigStatus.
+func (in *TagLabelSyncConfigStatus) DeepCopy() *TagLabelSyncConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TagLabelSyncConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,68 @@
+package autoscalinggroups
+
+import (
+	"context"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+
+	"tag-label-sync.io/aws"
+)
+
+type Service interface {
+	DescribeTagsPagesWithContext(awssdk.Context, *autoscaling.DescribeTagsInput, func(*autoscaling.DescribeTagsOutput, bool) bool, ...request.Option) error
+}
+
+// ClientFactory is used to inject the client as dependency into the reconciler
+type ClientFactory func(string) (*Client, error)
+
+// NewCachedClientFactory returns a ClientFactory whose clients share one SDK client per region.
+func NewCachedClientFactory() ClientFactory {
+	cache := aws.NewClientCache(func(region string) (interface{}, error) { return aws.NewAutoScalingClient(region) })
+	return func(region string) (*Client, error) {
+		c, err := cache.Get(region)
+		if err != nil {
+			return nil, err
+		}
+		return NewClientService(c.(Service)), nil
+	}
+}
+
+// Client reads the tags of Auto Scaling groups
+type Client struct {
+	internal Service
+}
+
+func NewClientService(internal Service) *Client {
+	return &Client{internal: internal}
+}
+
+func NewClient(region string) (*Client, error) {
+	c, err := aws.NewAutoScalingClient(region)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{internal: c}, nil
+}
+
+// PropagatedTags returns the tags of a group that are marked to be added to the instances it launches.
+func (c *Client) PropagatedTags(ctx context.Context, group string) (map[string]string, error) {
+	input := &autoscaling.DescribeTagsInput{
+		Filters: []*autoscaling.Filter{{Name: awssdk.String("auto-scaling-group"), Values: []*string{awssdk.String(group)}}},
+	}
+	tags := map[string]string{}
+	err := c.internal.DescribeTagsPagesWithContext(ctx, input, func(page *autoscaling.DescribeTagsOutput, lastPage bool) bool {
+		for _, tag := range page.Tags {
+			if awssdk.BoolValue(tag.PropagateAtLaunch) {
+				tags[awssdk.StringValue(tag.Key)] = awssdk.StringValue(tag.Value)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
@@ -0,0 +1,41 @@
+package aws
+
+import (
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const userAgent string = "tag-label-sync"
+
+// newSession reads credentials the same way as the AWS CLI: from the environment, the shared config
+// files, a web identity token or the instance's role.
+func newSession(region string) (*session.Session, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            awssdk.Config{Region: awssdk.String(region)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sess.Handlers.Build.PushBack(request.MakeAddToUserAgentFreeFormHandler(userAgent))
+	return sess, nil
+}
+
+func NewEC2Client(region string) (*ec2.EC2, error) {
+	sess, err := newSession(region)
+	if err != nil {
+		return nil, err
+	}
+	return ec2.New(sess), nil
+}
+
+func NewAutoScalingClient(region string) (*autoscaling.AutoScaling, error) {
+	sess, err := newSession(region)
+	if err != nil {
+		return nil, err
+	}
+	return autoscaling.New(sess), nil
+}
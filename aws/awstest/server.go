@@ -0,0 +1,286 @@
+// Package awstest is a stand-in for the parts of the EC2 and Auto Scaling APIs the controller uses,
+// so it can be tested without an AWS account.
+package awstest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"tag-label-sync.io/aws/autoscalinggroups"
+	"tag-label-sync.io/aws/instances"
+)
+
+// EC2 limits on the tags of a resource.
+const (
+	MaxTags        = 50
+	MaxKeyLen      = 128
+	MaxValueLen    = 256
+	ReservedPrefix = "aws:"
+)
+
+const (
+	ec2Version         = "2016-11-15"
+	autoScalingVersion = "2011-01-01"
+)
+
+// GroupTag is a tag of an Auto Scaling group.
+type GroupTag struct {
+	Value             string
+	PropagateAtLaunch bool
+}
+
+// Server answers EC2 and Auto Scaling query API requests from memory. Its InstanceClients and
+// AutoScalingGroupClients create SDK clients that call it.
+type Server struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// Instances are the tags of each instance, by instance ID.
+	Instances map[string]map[string]string
+	// Groups are the tags of each Auto Scaling group, by name.
+	Groups map[string]map[string]GroupTag
+	// Requests counts the requests for each action.
+	Requests map[string]int
+}
+
+// InstanceClients returns an instances.ClientFactory of EC2 clients that call s with fake credentials.
+func (s *Server) InstanceClients() instances.ClientFactory {
+	return func(region string) (*instances.Client, error) {
+		return instances.NewClientService(ec2.New(s.session(region))), nil
+	}
+}
+
+// AutoScalingGroupClients returns an autoscalinggroups.ClientFactory of Auto Scaling clients that call
+// s with fake credentials.
+func (s *Server) AutoScalingGroupClients() autoscalinggroups.ClientFactory {
+	return func(region string) (*autoscalinggroups.Client, error) {
+		return autoscalinggroups.NewClientService(autoscaling.New(s.session(region))), nil
+	}
+}
+
+func (s *Server) session(region string) *session.Session {
+	return session.Must(session.NewSession(&awssdk.Config{
+		Region:      awssdk.String(region),
+		Endpoint:    awssdk.String(s.URL),
+		Credentials: credentials.NewStaticCredentials("test", "test", ""),
+	}))
+}
+
+func NewServer() *Server {
+	s := &Server{
+		Instances: map[string]map[string]string{},
+		Groups:    map[string]map[string]GroupTag{},
+		Requests:  map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// InstanceTags returns a copy of an instance's tags.
+func (s *Server) InstanceTags(instanceID string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tags := map[string]string{}
+	for k, v := range s.Instances[instanceID] {
+		tags[k] = v
+	}
+	return tags
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedQueryString", err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	action := r.Form.Get("Action")
+	s.Requests[action]++
+
+	switch r.Form.Get("Version") + "/" + action {
+	case ec2Version + "/DescribeTags":
+		s.describeInstanceTags(w, r)
+	case ec2Version + "/CreateTags":
+		s.createTags(w, r)
+	case ec2Version + "/DeleteTags":
+		s.deleteTags(w, r)
+	case autoScalingVersion + "/DescribeTags":
+		s.describeGroupTags(w, r)
+	default:
+		writeError(w, http.StatusBadRequest, "InvalidAction", fmt.Sprintf("The action %s is not valid for this web service.", action))
+	}
+}
+
+type ec2Tag struct {
+	ResourceID   string `xml:"resourceId"`
+	ResourceType string `xml:"resourceType"`
+	Key          string `xml:"key"`
+	Value        string `xml:"value"`
+}
+
+func (s *Server) describeInstanceTags(w http.ResponseWriter, r *http.Request) {
+	ids := filterValues(r, "Filter.%d.Name", "Filter.%d.Value.%d", "resource-id")
+	var tags []ec2Tag
+	for _, id := range ids {
+		for _, key := range sortedKeys(s.Instances[id]) {
+			tags = append(tags, ec2Tag{ResourceID: id, ResourceType: "instance", Key: key, Value: s.Instances[id][key]})
+		}
+	}
+	writeXML(w, struct {
+		XMLName   xml.Name `xml:"DescribeTagsResponse"`
+		RequestID string   `xml:"requestId"`
+		Tags      []ec2Tag `xml:"tagSet>item"`
+	}{RequestID: "describe-tags", Tags: tags})
+}
+
+func (s *Server) createTags(w http.ResponseWriter, r *http.Request) {
+	ids := indexed(r, "ResourceId.%d")
+	keys := indexed(r, "Tag.%d.Key")
+	for _, id := range ids {
+		if _, ok := s.Instances[id]; !ok {
+			writeError(w, http.StatusBadRequest, "InvalidInstanceID.NotFound", fmt.Sprintf("The instance ID '%s' does not exist", id))
+			return
+		}
+	}
+	for i, key := range keys {
+		value := r.Form.Get(fmt.Sprintf("Tag.%d.Value", i+1))
+		switch {
+		case strings.HasPrefix(strings.ToLower(key), ReservedPrefix):
+			writeError(w, http.StatusBadRequest, "InvalidParameterValue", "Tag keys starting with 'aws:' are reserved for internal use")
+			return
+		case len(key) > MaxKeyLen || len(value) > MaxValueLen:
+			writeError(w, http.StatusBadRequest, "InvalidParameterValue", fmt.Sprintf("Tag %s is too long", key))
+			return
+		}
+	}
+	for _, id := range ids {
+		tags := map[string]string{}
+		for k, v := range s.Instances[id] {
+			tags[k] = v
+		}
+		for i, key := range keys {
+			tags[key] = r.Form.Get(fmt.Sprintf("Tag.%d.Value", i+1))
+		}
+		if len(tags) > MaxTags {
+			writeError(w, http.StatusBadRequest, "TagLimitExceeded", fmt.Sprintf("The maximum number of tags for the resource %s was exceeded", id))
+			return
+		}
+		s.Instances[id] = tags
+	}
+	writeXML(w, struct {
+		XMLName   xml.Name `xml:"CreateTagsResponse"`
+		RequestID string   `xml:"requestId"`
+		Return    bool     `xml:"return"`
+	}{RequestID: "create-tags", Return: true})
+}
+
+func (s *Server) deleteTags(w http.ResponseWriter, r *http.Request) {
+	for _, id := range indexed(r, "ResourceId.%d") {
+		for _, key := range indexed(r, "Tag.%d.Key") {
+			delete(s.Instances[id], key)
+		}
+	}
+	writeXML(w, struct {
+		XMLName   xml.Name `xml:"DeleteTagsResponse"`
+		RequestID string   `xml:"requestId"`
+		Return    bool     `xml:"return"`
+	}{RequestID: "delete-tags", Return: true})
+}
+
+type groupTag struct {
+	ResourceID        string `xml:"ResourceId"`
+	ResourceType      string `xml:"ResourceType"`
+	Key               string `xml:"Key"`
+	Value             string `xml:"Value"`
+	PropagateAtLaunch bool   `xml:"PropagateAtLaunch"`
+}
+
+func (s *Server) describeGroupTags(w http.ResponseWriter, r *http.Request) {
+	names := filterValues(r, "Filters.member.%d.Name", "Filters.member.%d.Values.member.%d", "auto-scaling-group")
+	var tags []groupTag
+	for _, name := range names {
+		group := s.Groups[name]
+		keys := make([]string, 0, len(group))
+		for k := range group {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			tags = append(tags, groupTag{ResourceID: name, ResourceType: "auto-scaling-group", Key: key, Value: group[key].Value, PropagateAtLaunch: group[key].PropagateAtLaunch})
+		}
+	}
+	writeXML(w, struct {
+		XMLName   xml.Name   `xml:"DescribeTagsResponse"`
+		Tags      []groupTag `xml:"DescribeTagsResult>Tags>member"`
+		RequestID string     `xml:"ResponseMetadata>RequestId"`
+	}{Tags: tags, RequestID: "describe-tags"})
+}
+
+// indexed returns the values of a list parameter, e.g. ResourceId.1, ResourceId.2 and so on.
+func indexed(r *http.Request, format string) []string {
+	var values []string
+	for i := 1; ; i++ {
+		value, ok := r.Form[fmt.Sprintf(format, i)]
+		if !ok {
+			return values
+		}
+		values = append(values, value[0])
+	}
+}
+
+// filterValues returns the values of the named filter.
+func filterValues(r *http.Request, nameFormat, valueFormat, name string) []string {
+	var values []string
+	for i := 1; ; i++ {
+		filter, ok := r.Form[fmt.Sprintf(nameFormat, i)]
+		if !ok {
+			return values
+		}
+		if filter[0] != name {
+			continue
+		}
+		for j := 1; ; j++ {
+			value, ok := r.Form[fmt.Sprintf(valueFormat, i, j)]
+			if !ok {
+				break
+			}
+			values = append(values, value[0])
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "text/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName   xml.Name `xml:"Response"`
+		Code      string   `xml:"Errors>Error>Code"`
+		Message   string   `xml:"Errors>Error>Message"`
+		RequestID string   `xml:"RequestID"`
+	}{Code: code, Message: message, RequestID: "error"})
+}
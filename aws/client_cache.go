@@ -0,0 +1,36 @@
+package aws
+
+import (
+	"sync"
+)
+
+// ClientCache creates the SDK client of one service once for each region and shares it, so a session
+// isn't set up and credentials aren't read again for every node. The service packages wrap it in
+// their ClientFactory.
+type ClientCache struct {
+	newClient func(region string) (interface{}, error)
+
+	mu      sync.Mutex
+	clients map[string]interface{}
+}
+
+// NewClientCache returns a cache of the clients newClient creates.
+func NewClientCache(newClient func(region string) (interface{}, error)) *ClientCache {
+	return &ClientCache{newClient: newClient, clients: map[string]interface{}{}}
+}
+
+// Get returns the client for the region, creating it the first time. A client that failed to be
+// created isn't cached, so it's tried again.
+func (c *ClientCache) Get(region string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[region]; ok {
+		return client, nil
+	}
+	client, err := c.newClient(region)
+	if err != nil {
+		return nil, err
+	}
+	c.clients[region] = client
+	return client, nil
+}
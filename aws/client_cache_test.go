@@ -0,0 +1,37 @@
+package aws
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClientCache(t *testing.T) {
+	type client struct{ region string }
+	created := map[string]int{}
+	cache := NewClientCache(func(region string) (interface{}, error) {
+		created[region]++
+		if region == "" {
+			return nil, errors.New("no region")
+		}
+		return &client{region}, nil
+	})
+
+	a, err := cache.Get("us-west-2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := cache.Get("us-west-2")
+	other, _ := cache.Get("eu-west-1")
+	if a != b || a == other {
+		t.Errorf("clients aren't shared within a region only: %v, %v, %v", a, b, other)
+	}
+	if created["us-west-2"] != 1 {
+		t.Errorf("created the client %d times, want once", created["us-west-2"])
+	}
+
+	cache.Get("")
+	cache.Get("")
+	if created[""] != 2 {
+		t.Errorf("created the client %d times, want it tried again after failing", created[""])
+	}
+}
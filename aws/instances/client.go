@@ -0,0 +1,94 @@
+package instances
+
+import (
+	"context"
+
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"tag-label-sync.io/aws"
+)
+
+// AutoScalingGroupTag is the tag EC2 puts on instances launched by an Auto Scaling group.
+const AutoScalingGroupTag string = "aws:autoscaling:groupName"
+
+type Service interface {
+	DescribeTagsPagesWithContext(awssdk.Context, *ec2.DescribeTagsInput, func(*ec2.DescribeTagsOutput, bool) bool, ...request.Option) error
+	CreateTagsWithContext(awssdk.Context, *ec2.CreateTagsInput, ...request.Option) (*ec2.CreateTagsOutput, error)
+	DeleteTagsWithContext(awssdk.Context, *ec2.DeleteTagsInput, ...request.Option) (*ec2.DeleteTagsOutput, error)
+}
+
+// ClientFactory is used to inject the client as dependency into the reconciler
+type ClientFactory func(string) (*Client, error)
+
+// NewCachedClientFactory returns a ClientFactory whose clients share one SDK client per region.
+func NewCachedClientFactory() ClientFactory {
+	cache := aws.NewClientCache(func(region string) (interface{}, error) { return aws.NewEC2Client(region) })
+	return func(region string) (*Client, error) {
+		c, err := cache.Get(region)
+		if err != nil {
+			return nil, err
+		}
+		return NewClientService(c.(Service)), nil
+	}
+}
+
+// Client reads and writes the tags of EC2 instances
+type Client struct {
+	internal Service
+}
+
+func NewClientService(internal Service) *Client {
+	return &Client{internal: internal}
+}
+
+func NewClient(region string) (*Client, error) {
+	c, err := aws.NewEC2Client(region)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{internal: c}, nil
+}
+
+// Tags returns the tags of an instance.
+func (c *Client) Tags(ctx context.Context, instanceID string) (map[string]string, error) {
+	input := &ec2.DescribeTagsInput{
+		Filters: []*ec2.Filter{{Name: awssdk.String("resource-id"), Values: []*string{awssdk.String(instanceID)}}},
+	}
+	tags := map[string]string{}
+	err := c.internal.DescribeTagsPagesWithContext(ctx, input, func(page *ec2.DescribeTagsOutput, lastPage bool) bool {
+		for _, tag := range page.Tags {
+			tags[awssdk.StringValue(tag.Key)] = awssdk.StringValue(tag.Value)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// UpdateTags sets and removes tags of an instance, leaving its other tags as they are.
+func (c *Client) UpdateTags(ctx context.Context, instanceID string, set map[string]string, remove []string) error {
+	if len(set) > 0 {
+		input := &ec2.CreateTagsInput{Resources: []*string{awssdk.String(instanceID)}}
+		for k, v := range set {
+			input.Tags = append(input.Tags, &ec2.Tag{Key: awssdk.String(k), Value: awssdk.String(v)})
+		}
+		if _, err := c.internal.CreateTagsWithContext(ctx, input); err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		input := &ec2.DeleteTagsInput{Resources: []*string{awssdk.String(instanceID)}}
+		for _, k := range remove {
+			input.Tags = append(input.Tags, &ec2.Tag{Key: awssdk.String(k)})
+		}
+		if _, err := c.internal.DeleteTagsWithContext(ctx, input); err != nil {
+			return err
+		}
+	}
+	return nil
+}
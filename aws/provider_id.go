@@ -0,0 +1,51 @@
+// example: aws:///us-west-2a/i-0123456789abcdef0
+
+package aws
+
+import (
+	"fmt"
+	"strings"
+)
+
+// providerIDPrefix is what the AWS cloud provider puts before the zone. Older clusters may have the
+// region between the slashes, e.g. aws://us-west-2/us-west-2a/i-0123456789abcdef0.
+const providerIDPrefix string = "aws://"
+
+type Instance struct {
+	AvailabilityZone string
+	Region           string
+	InstanceID       string
+}
+
+func ParseProviderID(providerID string) (Instance, error) {
+	if !strings.HasPrefix(providerID, providerIDPrefix) {
+		return Instance{}, fmt.Errorf("parsing failed for %s. Invalid provider ID format", providerID)
+	}
+	segments := strings.Split(strings.TrimPrefix(providerID, providerIDPrefix), "/")
+	if len(segments) != 3 || segments[1] == "" || !strings.HasPrefix(segments[2], "i-") {
+		return Instance{}, fmt.Errorf("parsing failed for %s. Invalid provider ID format", providerID)
+	}
+	zone := segments[1]
+	region, err := regionOf(zone)
+	if err != nil {
+		return Instance{}, fmt.Errorf("parsing failed for %s. %v", providerID, err)
+	}
+	return Instance{AvailabilityZone: zone, Region: region, InstanceID: segments[2]}, nil
+}
+
+// regionOf returns the region of an availability zone, which is the region with a letter added,
+// e.g. us-west-2a is in us-west-2.
+func regionOf(zone string) (string, error) {
+	if len(zone) < 2 || !isLower(zone[len(zone)-1]) || !isDigit(zone[len(zone)-2]) {
+		return "", fmt.Errorf("%s is not an availability zone", zone)
+	}
+	return zone[:len(zone)-1], nil
+}
+
+func isLower(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
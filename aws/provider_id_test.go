@@ -0,0 +1,31 @@
+package aws
+
+import (
+	"testing"
+)
+
+func TestParseProviderID(t *testing.T) {
+	tests := []struct {
+		providerID string
+		want       Instance
+		wantErr    bool
+	}{
+		{providerID: "aws:///us-west-2a/i-0123456789abcdef0", want: Instance{AvailabilityZone: "us-west-2a", Region: "us-west-2", InstanceID: "i-0123456789abcdef0"}},
+		{providerID: "aws://us-east-1/us-east-1c/i-0abc", want: Instance{AvailabilityZone: "us-east-1c", Region: "us-east-1", InstanceID: "i-0abc"}},
+		{providerID: "aws:///i-0abc", wantErr: true},
+		{providerID: "aws:///us-west-2/i-0abc", wantErr: true},
+		{providerID: "aws:///us-west-2a/node-0", wantErr: true},
+		{providerID: "gce://project/us-central1-a/instance", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseProviderID(tt.providerID)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseProviderID(%q) error = %v, wantErr %v", tt.providerID, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseProviderID(%q) = %+v, want %+v", tt.providerID, got, tt.want)
+		}
+	}
+}
@@ -4,47 +4,46 @@
 package azure
 
 import (
+	"github.com/Azure/go-autorest/autorest"
+
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-03-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/graphrbac/1.6/graphrbac"
 	"github.com/Azure/azure-sdk-for-go/services/msi/mgmt/2018-11-30/msi"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2019-05-01/resources"
 )
 
 const userAgent string = "genesys"
 
-func NewAvailabilitySetClient(subID string) (compute.AvailabilitySetsClient, error) {
+// configureResourceManagerClient sets up an ARM client's authorizer and user agent.
+func configureResourceManagerClient(client *autorest.Client) error {
 	a, err := injectAuthorizer()
 	if err != nil {
-		return compute.AvailabilitySetsClient{}, err
+		return err
 	}
-	client := compute.NewAvailabilitySetsClient(subID)
 	client.Authorizer = a
-	if err := client.AddToUserAgent(userAgent); err != nil {
+	return client.AddToUserAgent(userAgent)
+}
+
+func NewAvailabilitySetClient(subID string) (compute.AvailabilitySetsClient, error) {
+	client := compute.NewAvailabilitySetsClient(subID)
+	if err := configureResourceManagerClient(&client.Client); err != nil {
 		return compute.AvailabilitySetsClient{}, err
 	}
 	return client, nil
 }
 
 func NewVMClient(subID string) (compute.VirtualMachinesClient, error) {
-	a, err := injectAuthorizer()
-	if err != nil {
-		return compute.VirtualMachinesClient{}, err
-	}
 	client := compute.NewVirtualMachinesClient(subID)
-	client.Authorizer = a
-	if err := client.AddToUserAgent(userAgent); err != nil {
+	if err := configureResourceManagerClient(&client.Client); err != nil {
 		return compute.VirtualMachinesClient{}, err
 	}
 	return client, nil
 }
 
 func NewIdentityClient(subID string) (msi.UserAssignedIdentitiesClient, error) {
-	a, err := injectAuthorizer()
-	if err != nil {
-		return msi.UserAssignedIdentitiesClient{}, err
-	}
 	client := msi.NewUserAssignedIdentitiesClient(subID)
-	client.Authorizer = a
-	if err := client.AddToUserAgent(userAgent); err != nil {
+	if err := configureResourceManagerClient(&client.Client); err != nil {
 		return msi.UserAssignedIdentitiesClient{}, err
 	}
 	return client, nil
@@ -77,14 +76,50 @@ func NewApplicationClient(tenantID string) (graphrbac.ApplicationsClient, error)
 }
 
 func NewScaleSetClient(subID string) (compute.VirtualMachineScaleSetsClient, error) {
-	a, err := injectAuthorizer()
-	if err != nil {
-		return compute.VirtualMachineScaleSetsClient{}, err
-	}
 	client := compute.NewVirtualMachineScaleSetsClient(subID)
-	client.Authorizer = a
-	if err := client.AddToUserAgent(userAgent); err != nil {
+	if err := configureResourceManagerClient(&client.Client); err != nil {
 		return compute.VirtualMachineScaleSetsClient{}, err
 	}
 	return client, nil
 }
+
+func NewScaleSetVMClient(subID string) (compute.VirtualMachineScaleSetVMsClient, error) {
+	client := compute.NewVirtualMachineScaleSetVMsClient(subID)
+	if err := configureResourceManagerClient(&client.Client); err != nil {
+		return compute.VirtualMachineScaleSetVMsClient{}, err
+	}
+	return client, nil
+}
+
+func NewGroupsClient(subID string) (resources.GroupsClient, error) {
+	client := resources.NewGroupsClient(subID)
+	if err := configureResourceManagerClient(&client.Client); err != nil {
+		return resources.GroupsClient{}, err
+	}
+	return client, nil
+}
+
+// NewResourcesClient returns a client for Microsoft.Resources APIs the SDK has no client for yet.
+func NewResourcesClient(subID string) (resources.BaseClient, error) {
+	client := resources.New(subID)
+	if err := configureResourceManagerClient(&client.Client); err != nil {
+		return resources.BaseClient{}, err
+	}
+	return client, nil
+}
+
+func NewDisksClient(subID string) (compute.DisksClient, error) {
+	client := compute.NewDisksClient(subID)
+	if err := configureResourceManagerClient(&client.Client); err != nil {
+		return compute.DisksClient{}, err
+	}
+	return client, nil
+}
+
+func NewInterfacesClient(subID string) (network.InterfacesClient, error) {
+	client := network.NewInterfacesClient(subID)
+	if err := configureResourceManagerClient(&client.Client); err != nil {
+		return network.InterfacesClient{}, err
+	}
+	return client, nil
+}
@@ -0,0 +1,274 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+// Package azuretest is an in-memory stand-in for the ARM compute resources the controller uses, so it
+// can be tested without a subscription. Compute has Go fakes of the client services, and Server
+// serves the same resources over the ARM REST API.
+package azuretest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-03-01/compute"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+
+	"tag-label-sync.io/azure"
+	"tag-label-sync.io/azure/scalesets"
+	"tag-label-sync.io/azure/scalesetvms"
+	"tag-label-sync.io/azure/vms"
+)
+
+// Location is the location of every resource.
+const Location = "westus2"
+
+// The full types of the resources Compute has.
+const (
+	ScaleSetType   = "Microsoft.Compute/virtualMachineScaleSets"
+	ScaleSetVMType = "Microsoft.Compute/virtualMachineScaleSets/virtualMachines"
+	VMType         = "Microsoft.Compute/virtualMachines"
+)
+
+type resource struct {
+	id   *azure.ResourceID
+	tags map[string]string
+}
+
+// Compute holds scale sets, their VMs, and VMs, with only their tags.
+type Compute struct {
+	mu        sync.Mutex
+	resources map[string]*resource
+}
+
+func NewCompute() *Compute {
+	return &Compute{resources: map[string]*resource{}}
+}
+
+// key identifies a resource, as resource IDs are case-insensitive.
+func key(id *azure.ResourceID) string {
+	return strings.ToLower(id.String())
+}
+
+// Put adds a resource with the given tags, or replaces the tags of one that exists. It panics if the
+// resource ID isn't of one of the types Compute has.
+func (c *Compute) Put(resourceID string, tags map[string]string) {
+	id, err := azure.ParseResourceID(resourceID)
+	if err != nil {
+		panic(err)
+	}
+	if !id.IsType(ScaleSetType) && !id.IsType(ScaleSetVMType) && !id.IsType(VMType) {
+		panic(fmt.Sprintf("unsupported resource type %s", id.FullType()))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r, ok := c.resources[key(id)]; ok {
+		c.setTags(r, tags)
+		return
+	}
+	c.resources[key(id)] = &resource{id: id, tags: copyTags(tags)}
+}
+
+// Tags returns a copy of a resource's tags, or nil if there is no such resource.
+func (c *Compute) Tags(resourceID string) map[string]string {
+	id, err := azure.ParseResourceID(resourceID)
+	if err != nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.resources[key(id)]
+	if !ok {
+		return nil
+	}
+	return copyTags(r.tags)
+}
+
+func (c *Compute) get(id *azure.ResourceID) (*resource, error) {
+	r, ok := c.resources[key(id)]
+	if !ok {
+		return nil, autorest.DetailedError{
+			StatusCode: http.StatusNotFound,
+			Message:    fmt.Sprintf("The Resource '%s/%s' under resource group '%s' was not found.", id.FullType(), id.Name, id.ResourceGroup),
+		}
+	}
+	return r, nil
+}
+
+func (c *Compute) setTags(r *resource, tags map[string]string) {
+	r.tags = copyTags(tags)
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	if tags == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+	return copied
+}
+
+func resourceID(subscriptionID, group string, typesAndNames ...string) *azure.ResourceID {
+	id, err := azure.ParseResourceID(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/%s",
+		subscriptionID, group, strings.Join(typesAndNames, "/")))
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+func (r *resource) scaleSet() compute.VirtualMachineScaleSet {
+	return compute.VirtualMachineScaleSet{
+		ID:                               to.StringPtr(r.id.String()),
+		Name:                             to.StringPtr(r.id.Name),
+		Type:                             to.StringPtr(ScaleSetType),
+		Location:                         to.StringPtr(Location),
+		Tags:                             *to.StringMapPtr(r.tags),
+		VirtualMachineScaleSetProperties: &compute.VirtualMachineScaleSetProperties{},
+	}
+}
+
+func (r *resource) scaleSetVM() compute.VirtualMachineScaleSetVM {
+	return compute.VirtualMachineScaleSetVM{
+		ID:                                 to.StringPtr(r.id.String()),
+		Name:                               to.StringPtr(r.id.Parent.Name + "_" + r.id.Name),
+		InstanceID:                         to.StringPtr(r.id.Name),
+		Type:                               to.StringPtr(ScaleSetVMType),
+		Location:                           to.StringPtr(Location),
+		Tags:                               *to.StringMapPtr(r.tags),
+		VirtualMachineScaleSetVMProperties: &compute.VirtualMachineScaleSetVMProperties{},
+	}
+}
+
+func (r *resource) vm() compute.VirtualMachine {
+	return compute.VirtualMachine{
+		ID:                       to.StringPtr(r.id.String()),
+		Name:                     to.StringPtr(r.id.Name),
+		Type:                     to.StringPtr(VMType),
+		Location:                 to.StringPtr(Location),
+		Tags:                     *to.StringMapPtr(r.tags),
+		VirtualMachineProperties: &compute.VirtualMachineProperties{},
+	}
+}
+
+// ScaleSets returns a fake scalesets.Service for a subscription.
+func (c *Compute) ScaleSets(subscriptionID string) scalesets.Service {
+	return &scaleSetsService{compute: c, subscriptionID: subscriptionID}
+}
+
+// ScaleSetVMs returns a fake scalesetvms.Service for a subscription.
+func (c *Compute) ScaleSetVMs(subscriptionID string) scalesetvms.Service {
+	return &scaleSetVMsService{compute: c, subscriptionID: subscriptionID}
+}
+
+// VMs returns a fake vms.Service for a subscription.
+func (c *Compute) VMs(subscriptionID string) vms.Service {
+	return &vmsService{compute: c, subscriptionID: subscriptionID}
+}
+
+// ScaleSetClients returns a scalesets.ClientFactory of clients backed by c.
+func (c *Compute) ScaleSetClients() scalesets.ClientFactory {
+	return func(subscriptionID, group string) (*scalesets.Client, error) {
+		return scalesets.NewClientService(group, c.ScaleSets(subscriptionID)), nil
+	}
+}
+
+// ScaleSetVMClients returns a scalesetvms.ClientFactory of clients backed by c.
+func (c *Compute) ScaleSetVMClients() scalesetvms.ClientFactory {
+	return func(subscriptionID, group string) (*scalesetvms.Client, error) {
+		return scalesetvms.NewClientService(group, c.ScaleSetVMs(subscriptionID)), nil
+	}
+}
+
+// VMClients returns a vms.ClientFactory of clients backed by c.
+func (c *Compute) VMClients() vms.ClientFactory {
+	return func(subscriptionID, group string) (*vms.Client, error) {
+		return vms.NewClientService(group, c.VMs(subscriptionID)), nil
+	}
+}
+
+type scaleSetsService struct {
+	compute        *Compute
+	subscriptionID string
+}
+
+func (s *scaleSetsService) Get(ctx context.Context, group, name string) (compute.VirtualMachineScaleSet, error) {
+	s.compute.mu.Lock()
+	defer s.compute.mu.Unlock()
+	r, err := s.compute.get(resourceID(s.subscriptionID, group, "virtualMachineScaleSets", name))
+	if err != nil {
+		return compute.VirtualMachineScaleSet{}, err
+	}
+	return r.scaleSet(), nil
+}
+
+func (s *scaleSetsService) CreateOrUpdate(ctx context.Context, group, name string, vmss compute.VirtualMachineScaleSet) (compute.VirtualMachineScaleSet, error) {
+	s.compute.mu.Lock()
+	defer s.compute.mu.Unlock()
+	r, err := s.compute.get(resourceID(s.subscriptionID, group, "virtualMachineScaleSets", name))
+	if err != nil {
+		return compute.VirtualMachineScaleSet{}, err
+	}
+	s.compute.setTags(r, to.StringMap(vmss.Tags))
+	return r.scaleSet(), nil
+}
+
+type scaleSetVMsService struct {
+	compute        *Compute
+	subscriptionID string
+}
+
+func (s *scaleSetVMsService) Get(ctx context.Context, group, scaleSet, instanceID string) (compute.VirtualMachineScaleSetVM, error) {
+	s.compute.mu.Lock()
+	defer s.compute.mu.Unlock()
+	r, err := s.compute.get(resourceID(s.subscriptionID, group, "virtualMachineScaleSets", scaleSet, "virtualMachines", instanceID))
+	if err != nil {
+		return compute.VirtualMachineScaleSetVM{}, err
+	}
+	return r.scaleSetVM(), nil
+}
+
+func (s *scaleSetVMsService) Update(ctx context.Context, group, scaleSet, instanceID string, vm compute.VirtualMachineScaleSetVM) (compute.VirtualMachineScaleSetVM, error) {
+	s.compute.mu.Lock()
+	defer s.compute.mu.Unlock()
+	r, err := s.compute.get(resourceID(s.subscriptionID, group, "virtualMachineScaleSets", scaleSet, "virtualMachines", instanceID))
+	if err != nil {
+		return compute.VirtualMachineScaleSetVM{}, err
+	}
+	s.compute.setTags(r, to.StringMap(vm.Tags))
+	return r.scaleSetVM(), nil
+}
+
+type vmsService struct {
+	compute        *Compute
+	subscriptionID string
+}
+
+func (s *vmsService) Get(ctx context.Context, group, name string) (compute.VirtualMachine, error) {
+	s.compute.mu.Lock()
+	defer s.compute.mu.Unlock()
+	r, err := s.compute.get(resourceID(s.subscriptionID, group, "virtualMachines", name))
+	if err != nil {
+		return compute.VirtualMachine{}, err
+	}
+	return r.vm(), nil
+}
+
+func (s *vmsService) Update(ctx context.Context, group, name string, update compute.VirtualMachineUpdate) (compute.VirtualMachine, error) {
+	s.compute.mu.Lock()
+	defer s.compute.mu.Unlock()
+	r, err := s.compute.get(resourceID(s.subscriptionID, group, "virtualMachines", name))
+	if err != nil {
+		return compute.VirtualMachine{}, err
+	}
+	// a PATCH leaves the tags alone unless it has some
+	if update.Tags != nil {
+		s.compute.setTags(r, to.StringMap(update.Tags))
+	}
+	return r.vm(), nil
+}
@@ -0,0 +1,83 @@
+package azuretest
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+
+	"tag-label-sync.io/azure"
+	"tag-label-sync.io/azure/scalesets"
+	"tag-label-sync.io/azure/scalesetvms"
+	"tag-label-sync.io/azure/vms"
+)
+
+const rg = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/"
+
+func TestComputeFakes(t *testing.T) {
+	ctx := context.Background()
+	c := NewCompute()
+	c.Put(rg+"virtualMachineScaleSets/vmss", map[string]string{"env": "prod"})
+	c.Put(rg+"virtualMachineScaleSets/vmss/virtualMachines/0", nil)
+	c.Put(rg+"virtualMachines/vm", map[string]string{"env": "prod"})
+
+	vmss, err := scalesets.NewClientService("rg", c.ScaleSets("sub")).Get(ctx, "VMSS")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	vmss.Spec().Tags["team"] = to.StringPtr("infra")
+	if err := scalesets.NewClientService("rg", c.ScaleSets("sub")).Update(ctx, "vmss", vmss); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tags := c.Tags(rg + "virtualMachineScaleSets/vmss"); !reflect.DeepEqual(tags, map[string]string{"env": "prod", "team": "infra"}) {
+		t.Errorf("scale set tags = %v", tags)
+	}
+
+	vm, err := scalesetvms.NewClientService("rg", c.ScaleSetVMs("sub")).Get(ctx, "vmss", "0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if to.String(vm.Spec().InstanceID) != "0" || to.String(vm.Spec().Name) != "vmss_0" {
+		t.Errorf("scale set VM = %s %s", to.String(vm.Spec().Name), to.String(vm.Spec().InstanceID))
+	}
+
+	client := vms.NewClientService("rg", c.VMs("sub"))
+	if _, err := client.Get(ctx, "other"); !azure.IsNotFound(err) {
+		t.Errorf("Get() of a missing VM error = %v, want not found", err)
+	}
+	if _, err := vms.NewClientService("rg", c.VMs("other-sub")).Get(ctx, "vm"); !azure.IsNotFound(err) {
+		t.Errorf("Get() of a VM in another subscription error = %v, want not found", err)
+	}
+}
+
+func TestServerOperations(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Put(rg+"virtualMachines/vm", map[string]string{"env": "prod"})
+
+	req, _ := http.NewRequest(http.MethodPatch, s.URL+rg+"virtualMachines/vm?api-version="+apiVersion, strings.NewReader(`{"tags": {"env": "dev"}}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("PATCH status = %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+	if tags := s.Tags(rg + "virtualMachines/vm"); tags["env"] != "prod" {
+		t.Errorf("tags = %v, changed before the operation finished", tags)
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(s.URL + "/subscriptions/sub/providers/Microsoft.Compute/locations/" + Location + "/operations/operation-1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if tags := s.Tags(rg + "virtualMachines/vm"); tags["env"] != "dev" {
+		t.Errorf("tags = %v, want the operation applied", tags)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package azuretest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-03-01/compute"
+	"github.com/Azure/go-autorest/autorest"
+
+	"tag-label-sync.io/azure"
+	"tag-label-sync.io/azure/scalesets"
+	"tag-label-sync.io/azure/scalesetvms"
+	"tag-label-sync.io/azure/vms"
+)
+
+const apiVersion = "2019-03-01"
+
+// Server answers ARM requests for the resources in Compute: GET, PUT and PATCH of scale sets, their
+// VMs, and VMs. Only tags can be changed, and only of resources that exist. Its ScaleSetClients,
+// ScaleSetVMClients and VMClients create SDK clients that call it.
+//
+// Writes are long-running operations: they're accepted with an Azure-AsyncOperation header, and only
+// take effect once the operation is polled to completion, on the second poll.
+type Server struct {
+	*httptest.Server
+	*Compute
+
+	// Requests counts the requests for each method and resource type, e.g. "PUT virtualMachineScaleSets".
+	Requests   map[string]int
+	operations map[string]*operation
+}
+
+type operation struct {
+	polls int
+	apply func()
+}
+
+// NewServer serves the resources of a new Compute.
+func NewServer() *Server {
+	s := &Server{
+		Compute:    NewCompute(),
+		Requests:   map[string]int{},
+		operations: map[string]*operation{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// ScaleSetClients returns a scalesets.ClientFactory of SDK clients that call s without credentials.
+func (s *Server) ScaleSetClients() scalesets.ClientFactory {
+	return func(subscriptionID, group string) (*scalesets.Client, error) {
+		c := compute.NewVirtualMachineScaleSetsClientWithBaseURI(s.URL, subscriptionID)
+		c.Authorizer = autorest.NullAuthorizer{}
+		return scalesets.NewClientService(group, scalesets.NewService(c)), nil
+	}
+}
+
+// ScaleSetVMClients returns a scalesetvms.ClientFactory of SDK clients that call s without credentials.
+func (s *Server) ScaleSetVMClients() scalesetvms.ClientFactory {
+	return func(subscriptionID, group string) (*scalesetvms.Client, error) {
+		c := compute.NewVirtualMachineScaleSetVMsClientWithBaseURI(s.URL, subscriptionID)
+		c.Authorizer = autorest.NullAuthorizer{}
+		return scalesetvms.NewClientService(group, scalesetvms.NewService(c)), nil
+	}
+}
+
+// VMClients returns a vms.ClientFactory of SDK clients that call s without credentials.
+func (s *Server) VMClients() vms.ClientFactory {
+	return func(subscriptionID, group string) (*vms.Client, error) {
+		c := compute.NewVirtualMachinesClientWithBaseURI(s.URL, subscriptionID)
+		c.Authorizer = autorest.NullAuthorizer{}
+		return vms.NewClientService(group, vms.NewService(c)), nil
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// /subscriptions/{subscription}/providers/Microsoft.Compute/locations/{location}/operations/{name}
+	if segments := strings.Split(r.URL.Path, "/"); len(segments) > 2 && strings.EqualFold(segments[len(segments)-2], "operations") {
+		s.Requests[r.Method+" operations"]++
+		s.pollOperation(w, segments[len(segments)-1])
+		return
+	}
+
+	id, err := azure.ParseResourceID(r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidResourceId", err.Error())
+		return
+	}
+	var kind string
+	switch {
+	case id.IsType(ScaleSetType):
+		kind = "virtualMachineScaleSets"
+	case id.IsType(ScaleSetVMType):
+		kind = "virtualMachineScaleSets/virtualMachines"
+	case id.IsType(VMType):
+		kind = "virtualMachines"
+	default:
+		writeError(w, http.StatusBadRequest, "InvalidResourceType", fmt.Sprintf("The resource type '%s' could not be found.", id.FullType()))
+		return
+	}
+	s.Requests[r.Method+" "+kind]++
+
+	res, err := s.get(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "ResourceNotFound", err.Error())
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.writeResource(w, http.StatusOK, res)
+	case http.MethodPut, http.MethodPatch:
+		s.write(w, r, res)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", fmt.Sprintf("%s isn't supported for %s", r.Method, kind))
+	}
+}
+
+// write starts an operation to update the tags of a resource. A PUT replaces them, and a PATCH
+// replaces them only if the request has some.
+func (s *Server) write(w http.ResponseWriter, r *http.Request, res *resource) {
+	var body struct {
+		Tags map[string]*string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidRequestContent", err.Error())
+		return
+	}
+	if body.Tags == nil && r.Method == http.MethodPatch {
+		s.writeResource(w, http.StatusOK, res)
+		return
+	}
+	tags := map[string]string{}
+	for k, v := range body.Tags {
+		if v != nil {
+			tags[k] = *v
+		}
+	}
+
+	name := fmt.Sprintf("operation-%d", len(s.operations)+1)
+	s.operations[name] = &operation{apply: func() { s.setTags(res, tags) }}
+	w.Header().Set("Azure-AsyncOperation", fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Compute/locations/%s/operations/%s?api-version=%s",
+		s.URL, res.id.SubscriptionID, Location, name, apiVersion))
+	w.Header().Set("Retry-After", "0")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) pollOperation(w http.ResponseWriter, name string) {
+	op, ok := s.operations[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "OperationNotFound", fmt.Sprintf("The operation '%s' was not found.", name))
+		return
+	}
+	op.polls++
+	status := "InProgress"
+	if op.polls > 1 {
+		if op.apply != nil {
+			op.apply()
+			op.apply = nil
+		}
+		status = "Succeeded"
+	}
+	w.Header().Set("Retry-After", "0")
+	writeJSON(w, http.StatusOK, map[string]string{"name": name, "status": status})
+}
+
+func (s *Server) writeResource(w http.ResponseWriter, status int, res *resource) {
+	var v interface{}
+	switch {
+	case res.id.IsType(ScaleSetType):
+		v = res.scaleSet()
+	case res.id.IsType(ScaleSetVMType):
+		v = res.scaleSetVM()
+	default:
+		v = res.vm()
+	}
+	// the SDK doesn't marshal read-only properties like the name, so add them back
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalServerError", err.Error())
+		return
+	}
+	body := map[string]interface{}{}
+	_ = json.Unmarshal(b, &body)
+	body["id"] = res.id.String()
+	body["name"] = res.id.Name
+	if res.id.IsType(ScaleSetVMType) {
+		body["name"] = res.id.Parent.Name + "_" + res.id.Name
+		body["instanceId"] = res.id.Name
+	}
+	body["type"] = res.id.FullType()
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{"code": code, "message": message},
+	})
+}
@@ -0,0 +1,38 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package azure
+
+import (
+	"sync"
+)
+
+// ClientCache creates the SDK client of one service once for each subscription and shares it, so
+// auth isn't set up again for every client. The service packages wrap it in their ClientFactory.
+type ClientCache struct {
+	newClient func(subID string) (interface{}, error)
+
+	mu      sync.Mutex
+	clients map[string]interface{}
+}
+
+// NewClientCache returns a cache of the clients newClient creates.
+func NewClientCache(newClient func(subID string) (interface{}, error)) *ClientCache {
+	return &ClientCache{newClient: newClient, clients: map[string]interface{}{}}
+}
+
+// Get returns the client for the subscription, creating it the first time. A client that failed to
+// be created isn't cached, so it's tried again.
+func (c *ClientCache) Get(subID string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[subID]; ok {
+		return client, nil
+	}
+	client, err := c.newClient(subID)
+	if err != nil {
+		return nil, err
+	}
+	c.clients[subID] = client
+	return client, nil
+}
@@ -0,0 +1,46 @@
+package azure
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClientCache(t *testing.T) {
+	type client struct{ subID string }
+	created := map[string]int{}
+	fail := true
+	cache := NewClientCache(func(subID string) (interface{}, error) {
+		created[subID]++
+		if subID == "broken" && fail {
+			return nil, errors.New("no credentials")
+		}
+		return &client{subID}, nil
+	})
+
+	a, err := cache.Get("sub")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := cache.Get("sub")
+	other, _ := cache.Get("other-sub")
+	if a != b {
+		t.Errorf("the same subscription doesn't share the client")
+	}
+	if a == other {
+		t.Errorf("different subscriptions share the client")
+	}
+	if created["sub"] != 1 {
+		t.Errorf("created the client %d times, want once", created["sub"])
+	}
+
+	if _, err := cache.Get("broken"); err == nil {
+		t.Errorf("expected the error creating the client")
+	}
+	fail = false
+	if c, err := cache.Get("broken"); err != nil || c.(*client).subID != "broken" {
+		t.Errorf("Get() = %v, %v, want the client once it can be created", c, err)
+	}
+	if created["broken"] != 2 {
+		t.Errorf("created the client %d times, want it tried again after failing", created["broken"])
+	}
+}
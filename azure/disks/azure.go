@@ -0,0 +1,42 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package disks
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-03-01/compute"
+
+	"tag-label-sync.io/azure"
+)
+
+type client struct {
+	compute.DisksClient
+}
+
+func newClient(subID string) (*client, error) {
+	c, err := azure.NewDisksClient(subID)
+	if err != nil {
+		return nil, err
+	}
+	return &client{c}, nil
+}
+
+func (c *client) Get(ctx context.Context, group, name string) (compute.Disk, error) {
+	return c.DisksClient.Get(ctx, group, name)
+}
+
+func (c *client) Update(ctx context.Context, group, name string, disk compute.DiskUpdate) (compute.Disk, error) {
+	f, err := c.DisksClient.Update(ctx, group, name, disk)
+	if err != nil {
+		return compute.Disk{}, err
+	}
+
+	err = f.WaitForCompletionRef(ctx, c.Client)
+	if err != nil {
+		return compute.Disk{}, err
+	}
+
+	return f.Result(c.DisksClient)
+}
@@ -0,0 +1,70 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package disks
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-03-01/compute"
+
+	"tag-label-sync.io/azure"
+)
+
+type Service interface {
+	Get(context.Context, string, string) (compute.Disk, error)
+	Update(context.Context, string, string, compute.DiskUpdate) (compute.Disk, error)
+}
+
+// ClientFactory is used to inject the client as dependency into the reconciler
+type ClientFactory func(string, string) (*Client, error)
+
+// NewCachedClientFactory returns a ClientFactory whose clients share one SDK client per subscription.
+func NewCachedClientFactory() ClientFactory {
+	cache := azure.NewClientCache(func(subID string) (interface{}, error) { return newClient(subID) })
+	return func(subID, group string) (*Client, error) {
+		c, err := cache.Get(subID)
+		if err != nil {
+			return nil, err
+		}
+		return NewClientService(group, c.(Service)), nil
+	}
+}
+
+// Client reads and writes the tags of managed disks
+type Client struct {
+	group    string
+	internal Service
+}
+
+func NewClientService(group string, internal Service) *Client {
+	return &Client{group: group, internal: internal}
+}
+
+func NewClient(subID, group string) (*Client, error) {
+	c, err := newClient(subID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{group: group, internal: c}, nil
+}
+
+func (c *Client) Get(ctx context.Context, name string) (*Spec, error) {
+	disk, err := c.internal.Get(ctx, c.group, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Spec{internal: disk}, nil
+}
+
+// Update only sends the disk's tags.
+func (c *Client) Update(ctx context.Context, name string, spec *Spec) error {
+	result, err := c.internal.Update(ctx, c.group, name, compute.DiskUpdate{Tags: spec.internal.Tags})
+	if err != nil {
+		return err
+	}
+	spec.internal = result
+	return nil
+}
@@ -0,0 +1,31 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package disks
+
+import (
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-03-01/compute"
+)
+
+type SpecOption func(*Spec) *Spec
+
+type Spec struct {
+	internal compute.Disk
+}
+
+func (spec *Spec) Spec() compute.Disk {
+	return spec.internal
+}
+
+func Tags(tags map[string]*string) SpecOption {
+	return func(o *Spec) *Spec {
+		o.internal.Tags = tags
+		return o
+	}
+}
+
+func (spec *Spec) Set(options ...SpecOption) {
+	for _, option := range options {
+		spec = option(spec)
+	}
+}
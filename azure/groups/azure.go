@@ -0,0 +1,28 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package groups
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2019-05-01/resources"
+
+	"tag-label-sync.io/azure"
+)
+
+type client struct {
+	resources.GroupsClient
+}
+
+func newClient(subID string) (*client, error) {
+	c, err := azure.NewGroupsClient(subID)
+	if err != nil {
+		return nil, err
+	}
+	return &client{c}, nil
+}
+
+func (c *client) Get(ctx context.Context, name string) (resources.Group, error) {
+	return c.GroupsClient.Get(ctx, name)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package groups
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2019-05-01/resources"
+
+	"tag-label-sync.io/azure"
+)
+
+type Service interface {
+	Get(context.Context, string) (resources.Group, error)
+}
+
+// ClientFactory is used to inject the client as dependency into the reconciler
+type ClientFactory func(string) (*Client, error)
+
+// NewCachedClientFactory returns a ClientFactory that creates one client per subscription and reuses it.
+func NewCachedClientFactory() ClientFactory {
+	cache := azure.NewClientCache(func(subID string) (interface{}, error) { return newClient(subID) })
+	return func(subID string) (*Client, error) {
+		c, err := cache.Get(subID)
+		if err != nil {
+			return nil, err
+		}
+		return NewClientService(c.(Service)), nil
+	}
+}
+
+// Client reads resource groups. Their tags are only ever read, never written.
+type Client struct {
+	internal Service
+}
+
+func NewClientService(internal Service) *Client {
+	return &Client{internal: internal}
+}
+
+func NewClient(subID string) (*Client, error) {
+	c, err := newClient(subID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{internal: c}, nil
+}
+
+func (c *Client) Get(ctx context.Context, name string) (*Spec, error) {
+	group, err := c.internal.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Spec{internal: group}, nil
+}
@@ -0,0 +1,16 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package groups
+
+import (
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2019-05-01/resources"
+)
+
+type Spec struct {
+	internal resources.Group
+}
+
+func (spec *Spec) Spec() resources.Group {
+	return spec.internal
+}
@@ -0,0 +1,42 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package interfaces
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+
+	"tag-label-sync.io/azure"
+)
+
+type client struct {
+	network.InterfacesClient
+}
+
+func newClient(subID string) (*client, error) {
+	c, err := azure.NewInterfacesClient(subID)
+	if err != nil {
+		return nil, err
+	}
+	return &client{c}, nil
+}
+
+func (c *client) Get(ctx context.Context, group, name string) (network.Interface, error) {
+	return c.InterfacesClient.Get(ctx, group, name, "")
+}
+
+func (c *client) UpdateTags(ctx context.Context, group, name string, tags network.TagsObject) (network.Interface, error) {
+	f, err := c.InterfacesClient.UpdateTags(ctx, group, name, tags)
+	if err != nil {
+		return network.Interface{}, err
+	}
+
+	err = f.WaitForCompletionRef(ctx, c.Client)
+	if err != nil {
+		return network.Interface{}, err
+	}
+
+	return f.Result(c.InterfacesClient)
+}
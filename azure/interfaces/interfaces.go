@@ -0,0 +1,31 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package interfaces
+
+import (
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-06-01/network"
+)
+
+type SpecOption func(*Spec) *Spec
+
+type Spec struct {
+	internal network.Interface
+}
+
+func (spec *Spec) Spec() network.Interface {
+	return spec.internal
+}
+
+func Tags(tags map[string]*string) SpecOption {
+	return func(o *Spec) *Spec {
+		o.internal.Tags = tags
+		return o
+	}
+}
+
+func (spec *Spec) Set(options ...SpecOption) {
+	for _, option := range options {
+		spec = option(spec)
+	}
+}
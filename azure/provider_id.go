@@ -4,47 +4,152 @@ package azure
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
-	// "github.com/Azure/go-autorest/autorest/azure"
 )
 
+const providerIDPrefix string = "azure://"
+
+// Resource is the VM or scale set a node's provider ID names.
 type Resource struct {
 	SubscriptionID string
 	ResourceGroup  string
 	Provider       string
 	ResourceType   string
 	ResourceName   string
+	InstanceID     string // set for VMs in a scale set
+	// ID is the full resource ID, which for a VM in a scale set is the VM's own.
+	ID *ResourceID
 }
 
+// ParseProviderID parses the provider ID of a node on a VM, or on a VM in a scale set, whose
+// resource is then the scale set.
 func ParseProviderID(providerID string) (Resource, error) {
-	// return azure.ParseResourceID(providerID)
-	return parseResourceID(providerID)
+	if len(providerID) < len(providerIDPrefix) || !strings.EqualFold(providerID[:len(providerIDPrefix)], providerIDPrefix) {
+		return Resource{}, &ResourceIDError{ID: providerID, Reason: fmt.Sprintf("provider ID doesn't start with %s", providerIDPrefix)}
+	}
+	id, err := ParseResourceID(providerID[len(providerIDPrefix):])
+	if err != nil {
+		return Resource{}, err
+	}
+
+	resource := Resource{SubscriptionID: id.SubscriptionID, ResourceGroup: id.ResourceGroup, Provider: id.Provider, ID: id}
+	switch root := id.Root(); {
+	case id.Parent == nil:
+		resource.ResourceType, resource.ResourceName = id.Type, id.Name
+	case id.Parent == root:
+		resource.ResourceType, resource.ResourceName, resource.InstanceID = root.Type, root.Name, id.Name
+	default:
+		return Resource{}, &ResourceIDError{ID: providerID, Reason: "nested too deeply for a node's resource"}
+	}
+	return resource, nil
+}
+
+// ResourceID is a parsed ARM resource ID of the form
+// /subscriptions/{subscription}/resourceGroups/{group}/providers/{namespace}/{type}/{name}, where a
+// child resource adds its own type and name after those of its parent, e.g. a VM in a scale set is
+// .../providers/Microsoft.Compute/virtualMachineScaleSets/{scale set}/virtualMachines/{instance ID}.
+// See https://docs.microsoft.com/en-us/azure/azure-resource-manager/resource-group-template-functions-resource#resourceid.
+type ResourceID struct {
+	SubscriptionID string
+	ResourceGroup  string
+	// Provider is the resource provider namespace, e.g. Microsoft.Compute.
+	Provider string
+	Type     string
+	Name     string
+	// Parent is the resource this one is a child of, or nil for a top-level resource.
+	Parent *ResourceID
+}
+
+// ResourceIDError is returned for a string that isn't a resource ID that can be parsed.
+type ResourceIDError struct {
+	ID     string
+	Reason string
+}
+
+func (e *ResourceIDError) Error() string {
+	return fmt.Sprintf("parsing failed for %s: %s", e.ID, e.Reason)
+}
+
+// IsInvalidResourceID is true if the error is from parsing an invalid resource ID.
+func IsInvalidResourceID(err error) bool {
+	_, ok := err.(*ResourceIDError)
+	return ok
 }
 
-// ParseResourceID parses a resource ID into a ResourceDetails struct.
-// See https://docs.microsoft.com/en-us/azure/azure-resource-manager/resource-group-template-functions-resource#return-value-4.
-func parseResourceID(resourceID string) (Resource, error) {
+// Fixed segment names, which are matched case-insensitively.
+const (
+	subscriptionsSegment  string = "subscriptions"
+	resourceGroupsSegment string = "resourceGroups"
+	providersSegment      string = "providers"
+)
 
-	const resourceIDPatternText = `(?i)subscriptions/(.+)/resourceGroups/(.+)/providers/(.+?)/(.+?)/(.+)`
-	resourceIDPattern := regexp.MustCompile(resourceIDPatternText)
-	match := resourceIDPattern.FindStringSubmatch(resourceID)
+// ParseResourceID parses a resource ID. The names of the fixed segments are case-insensitive, and
+// everything else is kept as it is.
+func ParseResourceID(resourceID string) (*ResourceID, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return &ResourceIDError{ID: resourceID, Reason: fmt.Sprintf(format, args...)}
+	}
+	if !strings.HasPrefix(resourceID, "/") {
+		return nil, invalid("resource ID doesn't start with /")
+	}
+	segments := strings.Split(strings.TrimPrefix(resourceID, "/"), "/")
+	for i, segment := range segments {
+		if segment == "" {
+			return nil, invalid("segment %d is empty", i+1)
+		}
+	}
+	for i, name := range []string{subscriptionsSegment, resourceGroupsSegment, providersSegment} {
+		if len(segments) <= 2*i || !strings.EqualFold(segments[2*i], name) {
+			return nil, invalid("expected %s at segment %d", name, 2*i+1)
+		}
+	}
+	types := segments[5:]
+	if len(types) < 3 || len(types)%2 != 1 {
+		return nil, invalid("expected a provider namespace followed by pairs of resource type and name")
+	}
 
-	if len(match) == 0 {
-		return Resource{}, fmt.Errorf("parsing failed for %s. Invalid resource Id format", resourceID)
+	var id *ResourceID
+	for i := 1; i < len(types); i += 2 {
+		id = &ResourceID{
+			SubscriptionID: segments[1],
+			ResourceGroup:  segments[3],
+			Provider:       types[0],
+			Type:           types[i],
+			Name:           types[i+1],
+			Parent:         id,
+		}
 	}
+	return id, nil
+}
 
-	v := strings.Split(match[5], "/")
-	// resourceName := v[len(v)-1]
-	resourceName := v[len(v)-3]
+// Root returns the top-level resource of a child resource, or the resource itself.
+func (id *ResourceID) Root() *ResourceID {
+	root := id
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	return root
+}
 
-	result := Resource{
-		SubscriptionID: match[1],
-		ResourceGroup:  match[2],
-		Provider:       match[3],
-		ResourceType:   match[4],
-		ResourceName:   resourceName,
+// FullType returns the provider namespace and the types of the resource and its parents, e.g.
+// Microsoft.Compute/virtualMachineScaleSets/virtualMachines.
+func (id *ResourceID) FullType() string {
+	if id.Parent == nil {
+		return id.Provider + "/" + id.Type
 	}
+	return id.Parent.FullType() + "/" + id.Type
+}
 
-	return result, nil
+// IsType is true if the resource has the given full type, compared case-insensitively.
+func (id *ResourceID) IsType(fullType string) bool {
+	return strings.EqualFold(id.FullType(), fullType)
+}
+
+// String returns the resource ID, with the fixed segments in their usual case.
+func (id *ResourceID) String() string {
+	if id.Parent != nil {
+		return fmt.Sprintf("%s/%s/%s", id.Parent, id.Type, id.Name)
+	}
+	return fmt.Sprintf("/%s/%s/%s/%s/%s/%s/%s/%s", subscriptionsSegment, id.SubscriptionID, resourceGroupsSegment, id.ResourceGroup,
+		providersSegment, id.Provider, id.Type, id.Name)
 }
@@ -0,0 +1,106 @@
+package azure
+
+import (
+	"testing"
+)
+
+const rg = "/subscriptions/sub/resourceGroups/rg/providers/"
+
+func TestParseProviderID(t *testing.T) {
+	tests := []struct {
+		providerID string
+		want       Resource
+		wantErr    bool
+	}{
+		{
+			providerID: "azure://" + rg + "Microsoft.Compute/virtualMachines/node-0",
+			want:       Resource{SubscriptionID: "sub", ResourceGroup: "rg", Provider: "Microsoft.Compute", ResourceType: "virtualMachines", ResourceName: "node-0"},
+		},
+		{
+			providerID: "azure://" + rg + "Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/3",
+			want:       Resource{SubscriptionID: "sub", ResourceGroup: "rg", Provider: "Microsoft.Compute", ResourceType: "virtualMachineScaleSets", ResourceName: "vmss", InstanceID: "3"},
+		},
+		{
+			providerID: "AZURE:///Subscriptions/sub/resourcegroups/rg/PROVIDERS/microsoft.compute/virtualmachines/node-0",
+			want:       Resource{SubscriptionID: "sub", ResourceGroup: "rg", Provider: "microsoft.compute", ResourceType: "virtualmachines", ResourceName: "node-0"},
+		},
+		{providerID: rg + "Microsoft.Compute/virtualMachines/node-0", wantErr: true},
+		{providerID: "aws:///us-west-2a/i-0abc", wantErr: true},
+		{providerID: "azure://" + rg + "Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/3/networkInterfaces/nic", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseProviderID(tt.providerID)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseProviderID(%q) error = %v, wantErr %v", tt.providerID, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			if !IsInvalidResourceID(err) {
+				t.Errorf("ParseProviderID(%q) error = %v, want a ResourceIDError", tt.providerID, err)
+			}
+			continue
+		}
+		got.ID = nil
+		if got != tt.want {
+			t.Errorf("ParseProviderID(%q) = %+v, want %+v", tt.providerID, got, tt.want)
+		}
+	}
+}
+
+func TestParseResourceID(t *testing.T) {
+	id, err := ParseResourceID(rg + "Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id.Type != "virtualMachines" || id.Name != "3" || id.Parent == nil || id.Parent.Name != "vmss" || id.Parent.Parent != nil {
+		t.Errorf("ParseResourceID() = %+v, want a VM in the scale set", id)
+	}
+	if id.Root() != id.Parent || id.Parent.ResourceGroup != "rg" {
+		t.Errorf("Root() = %+v, want the scale set", id.Root())
+	}
+	if !id.IsType("microsoft.compute/virtualmachinescalesets/virtualmachines") || id.IsType("Microsoft.Compute/virtualMachines") {
+		t.Errorf("FullType() = %s", id.FullType())
+	}
+
+	for _, invalid := range []string{
+		"",
+		"subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/node-0",
+		"/subscriptions/sub/resourceGroups/rg",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines",
+		"/subscriptions/sub/resourceGroups//providers/Microsoft.Compute/virtualMachines/node-0",
+		"/subscriptions/sub/locations/rg/providers/Microsoft.Compute/virtualMachines/node-0",
+		"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/node-0/",
+	} {
+		if _, err := ParseResourceID(invalid); !IsInvalidResourceID(err) {
+			t.Errorf("ParseResourceID(%q) error = %v, want a ResourceIDError", invalid, err)
+		}
+	}
+}
+
+func TestResourceIDRoundTrip(t *testing.T) {
+	for _, resourceID := range []string{
+		rg + "Microsoft.Compute/virtualMachines/node-0",
+		rg + "Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/3",
+		rg + "Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/3/networkInterfaces/nic",
+		rg + "Microsoft.Network/networkInterfaces/nic0",
+	} {
+		id, err := ParseResourceID(resourceID)
+		if err != nil {
+			t.Errorf("ParseResourceID(%q) unexpected error: %v", resourceID, err)
+			continue
+		}
+		if got := id.String(); got != resourceID {
+			t.Errorf("ParseResourceID(%q).String() = %q", resourceID, got)
+		}
+	}
+
+	// the fixed segments come back in their usual case
+	id, err := ParseResourceID("/SUBSCRIPTIONS/sub/resourcegroups/RG/Providers/Microsoft.Compute/virtualMachines/node-0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "/subscriptions/sub/resourceGroups/RG/providers/Microsoft.Compute/virtualMachines/node-0"; id.String() != want {
+		t.Errorf("String() = %q, want %q", id.String(), want)
+	}
+}
@@ -15,6 +15,12 @@ type client struct {
 	compute.VirtualMachineScaleSetsClient
 }
 
+// NewService returns the Service of an SDK client that was set up elsewhere, e.g. against another
+// endpoint.
+func NewService(c compute.VirtualMachineScaleSetsClient) Service {
+	return &client{c}
+}
+
 func newClient(subID string) (*client, error) {
 	c, err := azure.NewScaleSetClient(subID)
 	if err != nil {
@@ -16,11 +16,30 @@ type Service interface {
 	CreateOrUpdate(context.Context, string, string, compute.VirtualMachineScaleSet) (compute.VirtualMachineScaleSet, error)
 }
 
+// ClientFactory is used to inject the client as dependency into the reconciler
+type ClientFactory func(string, string) (*Client, error)
+
+// NewCachedClientFactory returns a ClientFactory whose clients share one SDK client per subscription.
+func NewCachedClientFactory() ClientFactory {
+	cache := azure.NewClientCache(func(subID string) (interface{}, error) { return newClient(subID) })
+	return func(subID, group string) (*Client, error) {
+		c, err := cache.Get(subID)
+		if err != nil {
+			return nil, err
+		}
+		return NewClientService(group, c.(Service)), nil
+	}
+}
+
 type Client struct {
 	group    string
 	internal Service
 }
 
+func NewClientService(group string, internal Service) *Client {
+	return &Client{group: group, internal: internal}
+}
+
 func NewClient(subID, group string) (*Client, error) {
 	c, err := newClient(subID)
 	if err != nil {
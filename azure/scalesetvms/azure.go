@@ -0,0 +1,48 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package scalesetvms
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-03-01/compute"
+
+	"tag-label-sync.io/azure"
+)
+
+type client struct {
+	compute.VirtualMachineScaleSetVMsClient
+}
+
+// NewService returns the Service of an SDK client that was set up elsewhere, e.g. against another
+// endpoint.
+func NewService(c compute.VirtualMachineScaleSetVMsClient) Service {
+	return &client{c}
+}
+
+func newClient(subID string) (*client, error) {
+	c, err := azure.NewScaleSetVMClient(subID)
+	if err != nil {
+		return nil, err
+	}
+	return &client{c}, nil
+}
+
+func (c *client) Get(ctx context.Context, group, scaleSet, instanceID string) (compute.VirtualMachineScaleSetVM, error) {
+	return c.VirtualMachineScaleSetVMsClient.Get(ctx, group, scaleSet, instanceID)
+}
+
+func (c *client) Update(ctx context.Context, group, scaleSet, instanceID string, vm compute.VirtualMachineScaleSetVM) (compute.VirtualMachineScaleSetVM, error) {
+	f, err := c.VirtualMachineScaleSetVMsClient.Update(ctx, group, scaleSet, instanceID, vm)
+	if err != nil {
+		return compute.VirtualMachineScaleSetVM{}, err
+	}
+
+	err = f.WaitForCompletionRef(ctx, c.Client)
+	if err != nil {
+		return compute.VirtualMachineScaleSetVM{}, err
+	}
+
+	return f.Result(c.VirtualMachineScaleSetVMsClient)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package scalesetvms
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-03-01/compute"
+
+	"tag-label-sync.io/azure"
+)
+
+type Service interface {
+	Get(context.Context, string, string, string) (compute.VirtualMachineScaleSetVM, error)
+	Update(context.Context, string, string, string, compute.VirtualMachineScaleSetVM) (compute.VirtualMachineScaleSetVM, error)
+}
+
+// ClientFactory is used to inject the client as dependency into the reconciler
+type ClientFactory func(string, string) (*Client, error)
+
+// NewCachedClientFactory returns a ClientFactory whose clients share one SDK client per subscription.
+func NewCachedClientFactory() ClientFactory {
+	cache := azure.NewClientCache(func(subID string) (interface{}, error) { return newClient(subID) })
+	return func(subID, group string) (*Client, error) {
+		c, err := cache.Get(subID)
+		if err != nil {
+			return nil, err
+		}
+		return NewClientService(group, c.(Service)), nil
+	}
+}
+
+type Client struct {
+	group    string
+	internal Service
+}
+
+func NewClientService(group string, internal Service) *Client {
+	return &Client{group: group, internal: internal}
+}
+
+func NewClient(subID, group string) (*Client, error) {
+	c, err := newClient(subID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{group: group, internal: c}, nil
+}
+
+func (c *Client) Get(ctx context.Context, scaleSet, instanceID string) (*Spec, error) {
+	vm, err := c.internal.Get(ctx, c.group, scaleSet, instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Spec{internal: &vm}, nil
+}
+
+func (c *Client) Update(ctx context.Context, scaleSet, instanceID string, spec *Spec) error {
+	result, err := c.internal.Update(ctx, c.group, scaleSet, instanceID, *spec.internal)
+	if err != nil {
+		return err
+	}
+	spec.internal = &result
+	return nil
+}
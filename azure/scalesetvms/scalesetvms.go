@@ -0,0 +1,16 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package scalesetvms
+
+import (
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-03-01/compute"
+)
+
+type Spec struct {
+	internal *compute.VirtualMachineScaleSetVM
+}
+
+func (o *Spec) Spec() *compute.VirtualMachineScaleSetVM {
+	return o.internal
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package subscriptions
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2019-05-01/resources"
+	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+
+	"tag-label-sync.io/azure"
+)
+
+// tagsAPIVersion is the first version of the Tags API that can read the tags of a subscription,
+// which the SDK doesn't have a client for yet.
+const tagsAPIVersion string = "2019-10-01"
+
+type tagsResource struct {
+	Properties struct {
+		Tags map[string]*string `json:"tags"`
+	} `json:"properties"`
+}
+
+type client struct {
+	resources.BaseClient
+}
+
+func newClient(subID string) (*client, error) {
+	c, err := azure.NewResourcesClient(subID)
+	if err != nil {
+		return nil, err
+	}
+	return &client{c}, nil
+}
+
+func (c *client) GetTags(ctx context.Context) (map[string]*string, error) {
+	pathParameters := map[string]interface{}{
+		"subscriptionId": autorest.Encode("path", c.SubscriptionID),
+	}
+	queryParameters := map[string]interface{}{
+		"api-version": tagsAPIVersion,
+	}
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx),
+		autorest.AsGet(),
+		autorest.WithBaseURL(c.BaseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/providers/Microsoft.Resources/tags/default", pathParameters),
+		autorest.WithQueryParameters(queryParameters))
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "subscriptions.client", "GetTags", nil, "Failure preparing request")
+	}
+
+	resp, err := autorest.SendWithSender(c, req, autorest.GetSendDecorators(ctx, autorestazure.DoRetryWithRegistration(c.Client))...)
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "subscriptions.client", "GetTags", resp, "Failure sending request")
+	}
+
+	var result tagsResource
+	err = autorest.Respond(
+		resp,
+		c.ByInspecting(),
+		autorestazure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result),
+		autorest.ByClosing())
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "subscriptions.client", "GetTags", resp, "Failure responding to request")
+	}
+	return result.Properties.Tags, nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT license.
+
+package subscriptions
+
+import (
+	"context"
+
+	"tag-label-sync.io/azure"
+)
+
+type Service interface {
+	GetTags(context.Context) (map[string]*string, error)
+}
+
+// ClientFactory is used to inject the client as dependency into the reconciler
+type ClientFactory func(string) (*Client, error)
+
+// NewCachedClientFactory returns a ClientFactory that creates one client per subscription and reuses it.
+func NewCachedClientFactory() ClientFactory {
+	cache := azure.NewClientCache(func(subID string) (interface{}, error) { return newClient(subID) })
+	return func(subID string) (*Client, error) {
+		c, err := cache.Get(subID)
+		if err != nil {
+			return nil, err
+		}
+		return NewClientService(c.(Service)), nil
+	}
+}
+
+// Client reads the tags of a subscription. They are only ever read, never written.
+type Client struct {
+	internal Service
+}
+
+func NewClientService(internal Service) *Client {
+	return &Client{internal: internal}
+}
+
+func NewClient(subID string) (*Client, error) {
+	c, err := newClient(subID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{internal: c}, nil
+}
+
+func (c *Client) Tags(ctx context.Context) (map[string]*string, error) {
+	return c.internal.GetTags(ctx)
+}
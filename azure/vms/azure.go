@@ -15,6 +15,12 @@ type client struct {
 	compute.VirtualMachinesClient
 }
 
+// NewService returns the Service of an SDK client that was set up elsewhere, e.g. against another
+// endpoint.
+func NewService(c compute.VirtualMachinesClient) Service {
+	return &client{c}
+}
+
 func newClient(subID string) (*client, error) {
 	c, err := azure.NewVMClient(subID)
 	if err != nil {
@@ -26,3 +32,17 @@ func newClient(subID string) (*client, error) {
 func (c *client) Get(ctx context.Context, group, name string) (compute.VirtualMachine, error) {
 	return c.VirtualMachinesClient.Get(ctx, group, name, compute.InstanceView)
 }
+
+func (c *client) Update(ctx context.Context, group, name string, vm compute.VirtualMachineUpdate) (compute.VirtualMachine, error) {
+	f, err := c.VirtualMachinesClient.Update(ctx, group, name, vm)
+	if err != nil {
+		return compute.VirtualMachine{}, err
+	}
+
+	err = f.WaitForCompletionRef(ctx, c.Client)
+	if err != nil {
+		return compute.VirtualMachine{}, err
+	}
+
+	return f.Result(c.VirtualMachinesClient)
+}
@@ -12,6 +12,22 @@ import (
 
 type Service interface {
 	Get(context.Context, string, string) (compute.VirtualMachine, error)
+	Update(context.Context, string, string, compute.VirtualMachineUpdate) (compute.VirtualMachine, error)
+}
+
+// ClientFactory is used to inject the client as dependency into the reconciler
+type ClientFactory func(string, string) (*Client, error)
+
+// NewCachedClientFactory returns a ClientFactory whose clients share one SDK client per subscription.
+func NewCachedClientFactory() ClientFactory {
+	cache := azure.NewClientCache(func(subID string) (interface{}, error) { return newClient(subID) })
+	return func(subID, group string) (*Client, error) {
+		c, err := cache.Get(subID)
+		if err != nil {
+			return nil, err
+		}
+		return NewClientService(group, c.(Service)), nil
+	}
 }
 
 type Client struct {
@@ -43,3 +59,13 @@ func (c *Client) Get(ctx context.Context, name string) (*Spec, error) {
 
 	return &Spec{internal: vm}, nil
 }
+
+// Update only sends the VM's tags, so the instance view returned by Get is never written back.
+func (c *Client) Update(ctx context.Context, name string, spec *Spec) error {
+	result, err := c.internal.Update(ctx, c.group, name, compute.VirtualMachineUpdate{Tags: spec.internal.Tags})
+	if err != nil {
+		return err
+	}
+	spec.internal = result
+	return nil
+}
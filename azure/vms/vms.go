@@ -17,6 +17,19 @@ func (spec *Spec) Spec() compute.VirtualMachine {
 	return spec.internal
 }
 
+func Tags(tags map[string]*string) SpecOption {
+	return func(o *Spec) *Spec {
+		o.internal.Tags = tags
+		return o
+	}
+}
+
+func (spec *Spec) Set(options ...SpecOption) {
+	for _, option := range options {
+		spec = option(spec)
+	}
+}
+
 func defaultSpec() *Spec {
 	// shouild I fill this out?
 	return &Spec{compute.VirtualMachine{}}
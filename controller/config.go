@@ -1,16 +1,24 @@
 package controller
 
 import (
-	"encoding/json"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	taglabelv1 "tag-label-sync.io/api/v1"
+	"tag-label-sync.io/azure"
 )
 
 const (
-	DefaultLabelPrefix         string = "azure.tags"
-	DefaultTagPrefix           string = "node.labels"
-	DefaultResourceGroupFilter string = "none"
+	// the ConfigMap is still read if there is no TagLabelSyncConfig, to ease migration
+	ConfigMapName      string = "tag-label-sync"
+	ConfigMapNamespace string = "default"
+
+	// noResourceFilter is the legacy way of leaving resourceGroupFilter unset
+	noResourceFilter string = "none"
 )
 
 type SyncDirection string
@@ -29,77 +37,358 @@ const (
 	NodePrecedence ConflictPolicy = "node-precedence"
 )
 
+// ValuePolicy is what happens to tag values that aren't valid label values.
+type ValuePolicy string
+
+const (
+	EscapeValue     ValuePolicy = "escape"     // write invalid characters as '_' and two hex digits, as in names
+	SubstituteValue ValuePolicy = "substitute" // replace invalid characters with '-'
+	SkipValue       ValuePolicy = "skip"       // don't copy the tag to nodes
+)
+
+// TargetKind is the kind of node metadata ARM tags are copied to.
+type TargetKind string
+
+const (
+	LabelTarget      TargetKind = "label"
+	AnnotationTarget TargetKind = "annotation" // values are copied unchanged
+	// TaintTarget is only reported in conflicts, since taints come from tags under the taint tag prefix
+	TaintTarget TargetKind = "taint"
+)
+
+// TagSource is somewhere tags are inherited from, besides the node's own resource.
+type TagSource string
+
+const (
+	ResourceGroupTags    TagSource = "resource-group"
+	SubscriptionTags     TagSource = "subscription"
+	AutoScalingGroupTags TagSource = "auto-scaling-group"
+	NetworkTags          TagSource = "network-tags"
+)
+
+// AttachedResource is a kind of resource attached to a node's VM.
+type AttachedResource string
+
+const (
+	Disks             AttachedResource = "disks"
+	NetworkInterfaces AttachedResource = "network-interfaces"
+)
+
+// VMSSTarget is which resource is synced with nodes that run on scale set VMs.
+type VMSSTarget string
+
+const (
+	ScaleSet VMSSTarget = "scale-set"
+	Instance VMSSTarget = "instance" // tags of the scale set itself are inherited but never written
+)
+
 type ConfigOptions struct {
-	SyncDirection       SyncDirection  `json:"syncDirection"`       // how do I validate this?
-	Interval            string         `type:"int" json:"interval"` // how can I use a different type instead?
-	LabelPrefix         string         `json:"labelPrefix"`
-	TagPrefix           string         `json:"tagPrefix"`
-	ConflictPolicy      ConflictPolicy `json:"conflictPolicy"`
-	ResourceGroupFilter string         `json:"resourceGroupFilter"` // actually resource group filter
+	SyncDirection       SyncDirection      `json:"syncDirection"`
+	Interval            time.Duration      `json:"interval"`
+	LabelPrefix         string             `json:"labelPrefix"`
+	TagPrefix           string             `json:"tagPrefix"`
+	ConflictPolicy      ConflictPolicy     `json:"conflictPolicy"`
+	ResourceGroupFilter []string           `json:"resourceGroupFilter"` // patterns, empty for all resource groups
+	SubscriptionFilter  []string           `json:"subscriptionFilter"`  // patterns, empty for all subscriptions
+	VMSSTarget          VMSSTarget         `json:"vmssTarget"`
+	InheritFrom         []TagSource        `json:"inheritFrom"`
+	PropagateTo         []AttachedResource `json:"propagateTo"`
+	ValuePolicy         ValuePolicy        `json:"valuePolicy"`
+	TargetKind          TargetKind         `json:"targetKind"`
+	AnnotationTags      []string           `json:"annotationTags"` // patterns of tags copied to annotations whatever the target kind
+	AnnotationPrefix    string             `json:"annotationPrefix"`
+	TaintTagPrefix      string             `json:"taintTagPrefix"` // empty if tags are never turned into taints
+	TagFilter           KeyFilter          `json:"tagFilter"`      // ARM tags copied to nodes
+	LabelFilter         KeyFilter          `json:"labelFilter"`    // node labels copied to ARM
 }
 
+// NewConfigOptions reads options from the tag-label-sync ConfigMap. Every invalid option is
+// returned in one aggregated error. An empty prefix means the default prefix.
 func NewConfigOptions(configMap corev1.ConfigMap) (ConfigOptions, error) {
-	configOptions, err := loadConfigOptionsFromConfigMap(configMap)
-	if err != nil {
-		return ConfigOptions{}, err
+	fldPath := field.NewPath("data")
+	spec, allErrs := specFromConfigMap(configMap, fldPath)
+	for _, err := range spec.Validate(fldPath) {
+		// report key filter errors under the ConfigMap keys they came from
+		for specField, key := range configMapFilterFields {
+			err.Field = strings.Replace(err.Field, fldPath.Child(specField).String(), fldPath.Child(key).String(), 1)
+		}
+		allErrs = append(allErrs, err)
 	}
+	if len(allErrs) > 0 {
+		return ConfigOptions{}, allErrs.ToAggregate()
+	}
+
+	return configOptionsFromSpec(spec), nil
+}
 
-	if configOptions.SyncDirection != TwoWay &&
-		configOptions.SyncDirection != ARMToNode &&
-		configOptions.SyncDirection != NodeToARM {
-		configOptions.SyncDirection = ARMToNode
+// NewConfigOptionsFromSpec converts a TagLabelSyncConfig to ConfigOptions. Every invalid option
+// is returned in one aggregated error. Unlike in a ConfigMap, prefixes can be set to empty.
+func NewConfigOptionsFromSpec(spec taglabelv1.TagLabelSyncConfigSpec) (ConfigOptions, error) {
+	if allErrs := spec.Validate(field.NewPath("spec")); len(allErrs) > 0 {
+		return ConfigOptions{}, allErrs.ToAggregate()
 	}
 
-	// if _, err := strconv.Atoi(configOptions.Interval); err != nil {
-	if _, err := time.ParseDuration(configOptions.Interval); err != nil {
-		// error?
-		configOptions.Interval = "10h"
+	return configOptionsFromSpec(spec), nil
+}
+
+func configOptionsFromSpec(spec taglabelv1.TagLabelSyncConfigSpec) ConfigOptions {
+	configOptions := ConfigOptions{
+		SyncDirection:       SyncDirection(spec.SyncDirection),
+		LabelPrefix:         taglabelv1.DefaultLabelPrefix,
+		TagPrefix:           taglabelv1.DefaultTagPrefix,
+		ConflictPolicy:      ConflictPolicy(spec.ConflictPolicy),
+		ResourceGroupFilter: resourceFilter(spec.ResourceGroupFilter),
+		SubscriptionFilter:  resourceFilter(spec.SubscriptionFilter),
+		VMSSTarget:          VMSSTarget(spec.VMSSTarget),
+		ValuePolicy:         ValuePolicy(spec.ValuePolicy),
+		InheritFrom:         tagSources(spec.InheritFrom),
+		PropagateTo:         attachedResources(spec.PropagateTo),
+		TargetKind:          TargetKind(spec.TargetKind),
+		AnnotationTags:      spec.AnnotationTags,
+		TaintTagPrefix:      spec.TaintTagPrefix,
+		AnnotationPrefix:    taglabelv1.DefaultAnnotationPrefix,
+	}
+	if spec.Interval != nil {
+		configOptions.Interval = spec.Interval.Duration
+	}
+	if spec.LabelPrefix != nil {
+		configOptions.LabelPrefix = *spec.LabelPrefix
+	}
+	if spec.TagPrefix != nil {
+		configOptions.TagPrefix = *spec.TagPrefix
+	}
+	if spec.AnnotationPrefix != nil {
+		configOptions.AnnotationPrefix = *spec.AnnotationPrefix
+	}
+	if spec.TagFilter != nil {
+		configOptions.TagFilter = KeyFilter{Include: spec.TagFilter.Include, Exclude: spec.TagFilter.Exclude}
+	}
+	if spec.LabelFilter != nil {
+		configOptions.LabelFilter = KeyFilter{Include: spec.LabelFilter.Include, Exclude: spec.LabelFilter.Exclude}
 	}
 
-	// I need a different way to check if not set b/c I need to allow for empty prefixes
-	if configOptions.LabelPrefix == "" {
-		configOptions.LabelPrefix = DefaultLabelPrefix
+	return withDefaults(configOptions)
+}
+
+func tagSources(sources []string) []TagSource {
+	var result []TagSource
+	for _, source := range sources {
+		result = append(result, TagSource(source))
 	}
+	return result
+}
 
-	// also validate prefix?
-	if configOptions.TagPrefix == "" {
-		configOptions.TagPrefix = DefaultTagPrefix
+func attachedResources(kinds []string) []AttachedResource {
+	var result []AttachedResource
+	for _, kind := range kinds {
+		result = append(result, AttachedResource(kind))
 	}
+	return result
+}
 
-	if configOptions.ConflictPolicy != Ignore &&
-		configOptions.ConflictPolicy != ARMPrecedence &&
-		configOptions.ConflictPolicy != NodePrecedence {
-		configOptions.ConflictPolicy = ARMPrecedence
+// Propagates is true if tags copied from node labels are also written to the given kind of attached resource.
+func (c ConfigOptions) Propagates(kind AttachedResource) bool {
+	for _, k := range c.PropagateTo {
+		if k == kind {
+			return true
+		}
 	}
+	return false
+}
 
-	if configOptions.ResourceGroupFilter == "" {
-		configOptions.ResourceGroupFilter = DefaultResourceGroupFilter
+// Inherits is true if tags are inherited from source.
+func (c ConfigOptions) Inherits(source TagSource) bool {
+	for _, s := range c.InheritFrom {
+		if s == source {
+			return true
+		}
 	}
+	return false
+}
+
+// resourceFilter treats the legacy "none" as no filter
+func resourceFilter(patterns []string) []string {
+	if len(patterns) == 1 && strings.EqualFold(patterns[0], noResourceFilter) {
+		return nil
+	}
+	return patterns
+}
 
-	return configOptions, nil
+// Selects returns false if the resource is outside the resource group or subscription filter.
+func (c ConfigOptions) Selects(resource azure.Resource) bool {
+	return matchesResourceFilter(c.ResourceGroupFilter, resource.ResourceGroup) &&
+		matchesResourceFilter(c.SubscriptionFilter, resource.SubscriptionID)
+}
+
+// withDefaults fills in unset options. Options must have been validated first.
+func withDefaults(configOptions ConfigOptions) ConfigOptions {
+	defaults := DefaultConfigOptions()
+	if configOptions.SyncDirection == "" {
+		configOptions.SyncDirection = defaults.SyncDirection
+	}
+	if configOptions.Interval == 0 {
+		configOptions.Interval = defaults.Interval
+	}
+	if configOptions.ConflictPolicy == "" {
+		configOptions.ConflictPolicy = defaults.ConflictPolicy
+	}
+	if configOptions.VMSSTarget == "" {
+		configOptions.VMSSTarget = defaults.VMSSTarget
+	}
+	if configOptions.ValuePolicy == "" {
+		configOptions.ValuePolicy = defaults.ValuePolicy
+	}
+	if configOptions.TargetKind == "" {
+		configOptions.TargetKind = defaults.TargetKind
+	}
+	// an empty list, rather than an unset one, turns the default excludes off
+	if configOptions.LabelFilter.Exclude == nil {
+		configOptions.LabelFilter.Exclude = defaults.LabelFilter.Exclude
+	}
+
+	return configOptions
 }
 
 func DefaultConfigOptions() ConfigOptions {
 	return ConfigOptions{
-		SyncDirection:       ARMToNode,
-		Interval:            "1", // todo
-		LabelPrefix:         DefaultLabelPrefix,
-		TagPrefix:           DefaultTagPrefix,
-		ConflictPolicy:      ARMPrecedence,
-		ResourceGroupFilter: DefaultResourceGroupFilter,
+		SyncDirection:    SyncDirection(taglabelv1.DefaultSyncDirection),
+		Interval:         taglabelv1.DefaultInterval,
+		LabelPrefix:      taglabelv1.DefaultLabelPrefix,
+		TagPrefix:        taglabelv1.DefaultTagPrefix,
+		ConflictPolicy:   ConflictPolicy(taglabelv1.DefaultConflictPolicy),
+		VMSSTarget:       VMSSTarget(taglabelv1.DefaultVMSSTarget),
+		ValuePolicy:      ValuePolicy(taglabelv1.DefaultValuePolicy),
+		TargetKind:       TargetKind(taglabelv1.DefaultTargetKind),
+		AnnotationPrefix: taglabelv1.DefaultAnnotationPrefix,
+		LabelFilter:      KeyFilter{Exclude: taglabelv1.DefaultLabelExcludes},
 	}
 }
 
-func loadConfigOptionsFromConfigMap(configMap corev1.ConfigMap) (ConfigOptions, error) {
-	data, err := json.Marshal(configMap.Data)
-	if err != nil {
-		return ConfigOptions{}, err
+// ConfigMap keys. Lists have one item per line, and resource filters, inheritFrom and propagateTo can
+// also be comma-separated.
+const (
+	syncDirectionKey       string = "syncDirection"
+	conflictPolicyKey      string = "conflictPolicy"
+	intervalKey            string = "interval"
+	labelPrefixKey         string = "labelPrefix"
+	tagPrefixKey           string = "tagPrefix"
+	vmssTargetKey          string = "vmssTarget"
+	valuePolicyKey         string = "valuePolicy"
+	inheritFromKey         string = "inheritFrom"
+	propagateToKey         string = "propagateTo"
+	targetKindKey          string = "targetKind"
+	annotationTagsKey      string = "annotationTags"
+	annotationPrefixKey    string = "annotationPrefix"
+	taintTagPrefixKey      string = "taintTagPrefix"
+	tagIncludeKey          string = "tagInclude"
+	tagExcludeKey          string = "tagExclude"
+	labelIncludeKey        string = "labelInclude"
+	labelExcludeKey        string = "labelExclude"
+	resourceGroupFilterKey string = "resourceGroupFilter"
+	subscriptionFilterKey  string = "subscriptionFilter"
+	// older name for resourceGroupFilter, still accepted
+	legacyResourceGroupKey string = "resourceGroup"
+)
+
+var configMapKeys = []string{
+	syncDirectionKey, conflictPolicyKey, intervalKey, labelPrefixKey, tagPrefixKey, vmssTargetKey, valuePolicyKey,
+	targetKindKey, annotationTagsKey, annotationPrefixKey, taintTagPrefixKey, inheritFromKey, propagateToKey,
+	tagIncludeKey, tagExcludeKey, labelIncludeKey, labelExcludeKey,
+	resourceGroupFilterKey, subscriptionFilterKey, legacyResourceGroupKey,
+}
+
+// configMapFilterFields maps key filter fields of TagLabelSyncConfigSpec to ConfigMap keys
+var configMapFilterFields = map[string]string{
+	"tagFilter.include":   tagIncludeKey,
+	"tagFilter.exclude":   tagExcludeKey,
+	"labelFilter.include": labelIncludeKey,
+	"labelFilter.exclude": labelExcludeKey,
+}
+
+// specFromConfigMap reads the ConfigMap's options into a TagLabelSyncConfigSpec, returning errors for
+// unknown keys and values that can't be parsed.
+func specFromConfigMap(configMap corev1.ConfigMap, fldPath *field.Path) (taglabelv1.TagLabelSyncConfigSpec, field.ErrorList) {
+	allErrs := field.ErrorList{}
+	data := configMap.Data
+	for _, key := range sortedKeys(data) {
+		known := false
+		for _, k := range configMapKeys {
+			known = known || key == k
+		}
+		if !known {
+			allErrs = append(allErrs, field.NotSupported(fldPath, key, configMapKeys))
+		}
+	}
+
+	spec := taglabelv1.TagLabelSyncConfigSpec{
+		SyncDirection:      data[syncDirectionKey],
+		ConflictPolicy:     data[conflictPolicyKey],
+		VMSSTarget:         data[vmssTargetKey],
+		ValuePolicy:        data[valuePolicyKey],
+		TargetKind:         data[targetKindKey],
+		AnnotationTags:     patternList(data, annotationTagsKey),
+		TaintTagPrefix:     data[taintTagPrefixKey],
+		InheritFrom:        splitList(patternList(data, inheritFromKey)),
+		PropagateTo:        splitList(patternList(data, propagateToKey)),
+		SubscriptionFilter: splitList(patternList(data, subscriptionFilterKey)),
+	}
+	if interval, ok := data[intervalKey]; ok {
+		duration, err := time.ParseDuration(interval)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(intervalKey), interval, "must be a duration such as \"10m\" or \"2h30m\""))
+		} else {
+			spec.Interval = &metav1.Duration{Duration: duration}
+		}
+	}
+	// I need a different way to check if not set b/c I need to allow for empty prefixes
+	if labelPrefix := data[labelPrefixKey]; labelPrefix != "" {
+		spec.LabelPrefix = &labelPrefix
+	}
+	if tagPrefix := data[tagPrefixKey]; tagPrefix != "" {
+		spec.TagPrefix = &tagPrefix
+	}
+	if annotationPrefix := data[annotationPrefixKey]; annotationPrefix != "" {
+		spec.AnnotationPrefix = &annotationPrefix
+	}
+	resourceGroups := resourceGroupFilterKey
+	if _, ok := data[resourceGroups]; !ok {
+		resourceGroups = legacyResourceGroupKey
+	}
+	spec.ResourceGroupFilter = splitList(patternList(data, resourceGroups))
+	if filter := (taglabelv1.KeyFilter{Include: patternList(data, tagIncludeKey), Exclude: patternList(data, tagExcludeKey)}); filter.Include != nil || filter.Exclude != nil {
+		spec.TagFilter = &filter
+	}
+	if filter := (taglabelv1.KeyFilter{Include: patternList(data, labelIncludeKey), Exclude: patternList(data, labelExcludeKey)}); filter.Include != nil || filter.Exclude != nil {
+		spec.LabelFilter = &filter
 	}
 
-	configOptions := ConfigOptions{}
-	if err := json.Unmarshal(data, &configOptions); err != nil {
-		return ConfigOptions{}, err
+	return spec, allErrs
+}
+
+// patternList splits a ConfigMap value into patterns, one per line. Returns nil if the key isn't set.
+func patternList(data map[string]string, key string) []string {
+	value, ok := data[key]
+	if !ok {
+		return nil
+	}
+	patterns := []string{}
+	for _, line := range strings.Split(value, "\n") {
+		if pattern := strings.TrimSpace(line); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
 	}
+	return patterns
+}
 
-	return configOptions, nil
+// splitList splits comma-separated patterns, since resource group and subscription names can't contain commas
+func splitList(patterns []string) []string {
+	var result []string
+	for _, p := range patterns {
+		for _, item := range strings.Split(p, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
 }
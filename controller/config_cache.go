@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"strings"
+	"sync"
+)
+
+// configCache holds the options parsed from each config object, so they're only parsed again,
+// and invalid options only reported again, once the object changes.
+type configCache struct {
+	mu      sync.Mutex
+	entries map[string]configCacheEntry
+}
+
+type configCacheEntry struct {
+	resourceVersion string
+	configOptions   ConfigOptions
+	err             error
+}
+
+// get returns what was parsed for key, and false if nothing was parsed for this resourceVersion.
+func (c *configCache) get(key, resourceVersion string) (configCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || entry.resourceVersion != resourceVersion {
+		return configCacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *configCache) set(key, resourceVersion string, configOptions ConfigOptions, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]configCacheEntry{}
+	}
+	c.entries[key] = configCacheEntry{resourceVersion: resourceVersion, configOptions: configOptions, err: err}
+}
+
+// prune removes the entries whose key starts with prefix and isn't in keep, so configs that were
+// deleted don't stay cached.
+func (c *configCache) prune(prefix string, keep map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) && !keep[key] {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	taglabelv1 "tag-label-sync.io/api/v1"
+	"tag-label-sync.io/azure"
+)
+
+func TestNewConfigOptionsFromSpec(t *testing.T) {
+	empty := ""
+	spec := taglabelv1.TagLabelSyncConfigSpec{
+		SyncDirection:  string(TwoWay),
+		ConflictPolicy: string(NodePrecedence),
+		Interval:       &metav1.Duration{Duration: 5 * time.Minute},
+		LabelPrefix:    &empty,
+	}
+
+	configOptions, err := NewConfigOptionsFromSpec(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := ConfigOptions{
+		SyncDirection:    TwoWay,
+		Interval:         5 * time.Minute,
+		LabelPrefix:      "",
+		TagPrefix:        taglabelv1.DefaultTagPrefix,
+		ConflictPolicy:   NodePrecedence,
+		VMSSTarget:       ScaleSet,
+		ValuePolicy:      SubstituteValue,
+		TargetKind:       LabelTarget,
+		AnnotationPrefix: taglabelv1.DefaultAnnotationPrefix,
+		LabelFilter:      KeyFilter{Exclude: taglabelv1.DefaultLabelExcludes},
+	}
+	if !reflect.DeepEqual(configOptions, want) {
+		t.Errorf("NewConfigOptionsFromSpec() = %+v, want %+v", configOptions, want)
+	}
+}
+
+func TestNewConfigOptionsFilters(t *testing.T) {
+	configMap := corev1.ConfigMap{Data: map[string]string{
+		"syncDirection": "two-way",
+		"tagInclude":    "env\nregex:team-.*\n",
+		"labelExclude":  "",
+	}}
+
+	configOptions, err := NewConfigOptions(configMap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (KeyFilter{Include: []string{"env", "regex:team-.*"}}); !reflect.DeepEqual(configOptions.TagFilter, want) {
+		t.Errorf("TagFilter = %+v, want %+v", configOptions.TagFilter, want)
+	}
+	if want := (KeyFilter{Exclude: []string{}}); !reflect.DeepEqual(configOptions.LabelFilter, want) {
+		t.Errorf("LabelFilter = %+v, want %+v", configOptions.LabelFilter, want)
+	}
+
+	configMap.Data["labelInclude"] = "regex:("
+	if _, err := NewConfigOptions(configMap); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
+
+func TestResourceFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     map[string]string
+		resource azure.Resource
+		want     bool
+	}{
+		{name: "no filter", data: map[string]string{}, resource: azure.Resource{ResourceGroup: "rg1"}, want: true},
+		{name: "none is no filter", data: map[string]string{"resourceGroupFilter": "none"}, resource: azure.Resource{ResourceGroup: "rg1"}, want: true},
+		{name: "glob is case-insensitive", data: map[string]string{"resourceGroupFilter": "MC_*, byo-rg"}, resource: azure.Resource{ResourceGroup: "mc_rg_cluster_westus2"}, want: true},
+		{name: "outside resource group filter", data: map[string]string{"resourceGroupFilter": "MC_*\nbyo-rg"}, resource: azure.Resource{ResourceGroup: "other"}, want: false},
+		{name: "legacy resourceGroup key", data: map[string]string{"resourceGroup": "byo-rg"}, resource: azure.Resource{ResourceGroup: "other"}, want: false},
+		{name: "outside subscription filter", data: map[string]string{"subscriptionFilter": "1234*"}, resource: azure.Resource{SubscriptionID: "5678", ResourceGroup: "rg1"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configOptions, err := NewConfigOptions(corev1.ConfigMap{Data: tt.data})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := configOptions.Selects(tt.resource); got != tt.want {
+				t.Errorf("Selects(%+v) = %v, want %v", tt.resource, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewConfigOptionsInvalid(t *testing.T) {
+	configMap := corev1.ConfigMap{Data: map[string]string{
+		"syncDirection":  "two_way",
+		"conflictPolicy": "arm-precedence",
+		"interval":       "2",
+		"labelExclude":   "regex:(",
+		"resourceGroup":  "rg1",
+		"resourceGroups": "rg2",
+	}}
+
+	_, err := NewConfigOptions(configMap)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	for _, field := range []string{"data.syncDirection", "data.interval", "data.labelExclude[0]", "resourceGroups"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("expected error to mention %s, got: %v", field, err)
+		}
+	}
+}
+
+func TestNewConfigOptionsFromSpecInvalid(t *testing.T) {
+	labelPrefix := "Azure_Tags"
+	annotationPrefix := "tag-label-sync.io"
+	spec := taglabelv1.TagLabelSyncConfigSpec{
+		ConflictPolicy:   "node-first",
+		Interval:         &metav1.Duration{},
+		LabelPrefix:      &labelPrefix,
+		TargetKind:       "taint",
+		AnnotationPrefix: &annotationPrefix,
+	}
+
+	_, err := NewConfigOptionsFromSpec(spec)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	for _, field := range []string{"spec.conflictPolicy", "spec.interval", "spec.labelPrefix", "spec.targetKind", "spec.annotationPrefix"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("expected error to mention %s, got: %v", field, err)
+		}
+	}
+}
+
+func TestRequeueAfter(t *testing.T) {
+	configOptions := DefaultConfigOptions()
+	configOptions.Interval = time.Minute
+	for i := 0; i < 10; i++ {
+		if got := requeueAfter(configOptions); got < time.Minute || got > time.Minute+6*time.Second {
+			t.Errorf("requeueAfter() = %v, want between 1m and 1m6s", got)
+		}
+	}
+}
+
+func TestNewConfigOptionsPropagateTo(t *testing.T) {
+	configOptions, err := NewConfigOptions(corev1.ConfigMap{Data: map[string]string{"propagateTo": "disks\nnetwork-interfaces"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !configOptions.Propagates(Disks) || !configOptions.Propagates(NetworkInterfaces) {
+		t.Errorf("PropagateTo = %v, want both kinds", configOptions.PropagateTo)
+	}
+
+	_, err = NewConfigOptions(corev1.ConfigMap{Data: map[string]string{"propagateTo": "disks,public-ips"}})
+	if err == nil || !strings.Contains(err.Error(), "data.propagateTo[1]") {
+		t.Errorf("expected an error for the unknown kind, got: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	taglabelv1 "tag-label-sync.io/api/v1"
+)
+
+// KeyFilter decides which tag or label names are synced. A key is synced if it matches one of the
+// include patterns, or there are none, and doesn't match any of the exclude patterns. Patterns are
+// globs as in path.Match, or regular expressions prefixed with "regex:" that must match the whole key.
+type KeyFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// FilteredKey is a tag or label name that a KeyFilter kept from being synced.
+type FilteredKey struct {
+	Direction SyncDirection // direction in which the key was not synced
+	Key       string
+	Rule      string // the exclude pattern that matched, or notIncludedRule
+}
+
+// notIncludedRule is the rule reported for keys that don't match any include pattern.
+const notIncludedRule string = "not included"
+
+type keyMatcher struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+func newKeyMatcher(pattern string) (keyMatcher, error) {
+	if strings.HasPrefix(pattern, taglabelv1.RegexPrefix) {
+		regex, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", strings.TrimPrefix(pattern, taglabelv1.RegexPrefix)))
+		if err != nil {
+			return keyMatcher{}, fmt.Errorf("invalid key filter pattern %q: %v", pattern, err)
+		}
+		return keyMatcher{pattern: pattern, regex: regex}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return keyMatcher{}, fmt.Errorf("invalid key filter pattern %q: %v", pattern, err)
+	}
+	return keyMatcher{pattern: pattern}, nil
+}
+
+func (m keyMatcher) matches(key string) bool {
+	if m.regex != nil {
+		return m.regex.MatchString(key)
+	}
+	matched, _ := path.Match(m.pattern, key)
+	return matched
+}
+
+type compiledKeyFilter struct {
+	include []keyMatcher
+	exclude []keyMatcher
+}
+
+func compileKeyFilter(filter KeyFilter) (compiledKeyFilter, error) {
+	include, err := compilePatterns(filter.Include)
+	if err != nil {
+		return compiledKeyFilter{}, err
+	}
+	exclude, err := compilePatterns(filter.Exclude)
+	if err != nil {
+		return compiledKeyFilter{}, err
+	}
+	return compiledKeyFilter{include: include, exclude: exclude}, nil
+}
+
+func compilePatterns(patterns []string) ([]keyMatcher, error) {
+	var matchers []keyMatcher
+	for _, pattern := range patterns {
+		m, err := newKeyMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// matchesAny is true if key matches one of the patterns, and false if there are none.
+func matchesAny(matchers []keyMatcher, key string) bool {
+	for _, m := range matchers {
+		if m.matches(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// rejects returns the rule that keeps key from being synced, or "" if it should be synced.
+func (f compiledKeyFilter) rejects(key string) string {
+	if len(f.include) > 0 && !matchesAny(f.include, key) {
+		return notIncludedRule
+	}
+	for _, m := range f.exclude {
+		if m.matches(key) {
+			return m.pattern
+		}
+	}
+	return ""
+}
+
+// matchesResourceFilter is true if name matches one of the glob patterns, or there are none.
+// ARM names are case-insensitive, so the match is too.
+func matchesResourceFilter(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); matched {
+			return true
+		}
+	}
+	return false
+}
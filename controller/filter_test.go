@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	taglabelv1 "tag-label-sync.io/api/v1"
+)
+
+func TestKeyFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter KeyFilter
+		key    string
+		want   string
+	}{
+		{name: "no patterns syncs everything", filter: KeyFilter{}, key: "env", want: ""},
+		{name: "glob exclude", filter: KeyFilter{Exclude: taglabelv1.DefaultLabelExcludes}, key: "beta.kubernetes.io/arch", want: "*.kubernetes.io/*"},
+		{name: "glob exclude does not match other prefixes", filter: KeyFilter{Exclude: taglabelv1.DefaultLabelExcludes}, key: "azure.tags/env", want: ""},
+		{name: "not included", filter: KeyFilter{Include: []string{"team-*"}}, key: "env", want: notIncludedRule},
+		{name: "regex include", filter: KeyFilter{Include: []string{"regex:(env|team)"}}, key: "team", want: ""},
+		{name: "regex must match the whole key", filter: KeyFilter{Include: []string{"regex:env"}}, key: "environment", want: notIncludedRule},
+		{name: "exclude wins over include", filter: KeyFilter{Include: []string{"*"}, Exclude: []string{"regex:secret.*"}}, key: "secret-key", want: "regex:secret.*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := compileKeyFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := compiled.rejects(tt.key); got != tt.want {
+				t.Errorf("rejects(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyFilterInvalidPattern(t *testing.T) {
+	for _, pattern := range []string{"[", "regex:("} {
+		if _, err := compileKeyFilter(KeyFilter{Include: []string{pattern}}); err == nil {
+			t.Errorf("expected an error for pattern %q", pattern)
+		}
+	}
+}
+
+func TestComputeSyncPlanKeyFilters(t *testing.T) {
+	options := DefaultConfigOptions()
+	options.TagFilter = KeyFilter{Exclude: []string{"aks-*"}}
+	state := SyncState{
+		Labels:  map[string]string{"azure.tags/aks-managed": "true"},
+		Tags:    map[string]string{"aks-managed": "true", "env": "prod"},
+		Managed: ManagedKeys{Labels: []string{"azure.tags/aks-managed"}},
+	}
+
+	plan, err := ComputeSyncPlan(state, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(plan.LabelsToAdd, map[string]string{"azure.tags/env": "prod"}) {
+		t.Errorf("LabelsToAdd = %v", plan.LabelsToAdd)
+	}
+	// filtering a tag removes the label that was copied from it
+	if !reflect.DeepEqual(plan.LabelsToRemove, []string{"azure.tags/aks-managed"}) {
+		t.Errorf("LabelsToRemove = %v", plan.LabelsToRemove)
+	}
+	want := []FilteredKey{{Direction: ARMToNode, Key: "aks-managed", Rule: "aks-*"}}
+	if !reflect.DeepEqual(plan.Filtered, want) {
+		t.Errorf("Filtered = %v, want %v", plan.Filtered, want)
+	}
+}
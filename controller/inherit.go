@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/Azure/go-autorest/autorest/to"
+
+	"tag-label-sync.io/azure"
+)
+
+// inheritedTags reads the tags the node's resource inherits from its resource group and subscription,
+// as configured. Resource group tags take precedence over subscription tags.
+func inheritedTags(ctx context.Context, clients AzureClients, provider azure.Resource, configOptions ConfigOptions) (map[string]string, error) {
+	var subscriptionTags, groupTags map[string]string
+	if configOptions.Inherits(SubscriptionTags) {
+		client, err := clients.subscriptions(provider.SubscriptionID)
+		if err != nil {
+			return nil, err
+		}
+		tags, err := client.Tags(ctx)
+		if err != nil && !azure.IsNotFound(err) { // a subscription that was never tagged has no tags resource
+			return nil, err
+		}
+		subscriptionTags = to.StringMap(tags)
+	}
+	if configOptions.Inherits(ResourceGroupTags) {
+		client, err := clients.groups(provider.SubscriptionID)
+		if err != nil {
+			return nil, err
+		}
+		group, err := client.Get(ctx, provider.ResourceGroup)
+		if err != nil {
+			return nil, err
+		}
+		groupTags = to.StringMap(group.Spec().Tags)
+	}
+	return mergeTags(subscriptionTags, groupTags), nil
+}
+
+// mergeTags merges layers of tags, with each layer taking precedence over the ones before it.
+// Returns nil if there are no tags.
+func mergeTags(layers ...map[string]string) map[string]string {
+	var merged map[string]string
+	for _, layer := range layers {
+		for k, v := range layer {
+			if merged == nil {
+				merged = map[string]string{}
+			}
+			merged[k] = v
+		}
+	}
+	return merged
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMergeTags(t *testing.T) {
+	subscription := map[string]string{"costcenter": "1000", "org": "contoso"}
+	group := map[string]string{"costcenter": "2000", "team": "infra"}
+	vmss := map[string]string{"team": "gpu"}
+
+	got := mergeTags(subscription, group, vmss)
+	want := map[string]string{"costcenter": "2000", "org": "contoso", "team": "gpu"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeTags() = %v, want %v", got, want)
+	}
+	if got := mergeTags(nil, map[string]string{}); got != nil {
+		t.Errorf("mergeTags() with no tags = %v, want nil", got)
+	}
+}
+
+func TestComputeSyncPlanInherited(t *testing.T) {
+	options := DefaultConfigOptions()
+	options.SyncDirection = TwoWay
+	state := SyncState{
+		Labels:        map[string]string{"rack": "r1"},
+		Tags:          map[string]string{"costcenter": "3000"},
+		InheritedTags: mergeTags(map[string]string{"org": "contoso"}, map[string]string{"costcenter": "2000"}),
+	}
+
+	plan, err := ComputeSyncPlan(state, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"azure.tags/costcenter": "3000", "azure.tags/org": "contoso"}
+	if !reflect.DeepEqual(plan.LabelsToAdd, want) {
+		t.Errorf("LabelsToAdd = %v, want %v", plan.LabelsToAdd, want)
+	}
+	// inherited tags are never written, only the resource's own
+	if !reflect.DeepEqual(plan.TagsToAdd, map[string]string{"node.labels.rack": "r1"}) || len(plan.TagsToUpdate) != 0 {
+		t.Errorf("TagsToAdd = %v, TagsToUpdate = %v", plan.TagsToAdd, plan.TagsToUpdate)
+	}
+}
+
+func TestNewConfigOptionsInheritFrom(t *testing.T) {
+	configOptions, err := NewConfigOptions(corev1.ConfigMap{Data: map[string]string{"inheritFrom": "subscription, resource-group"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !configOptions.Inherits(ResourceGroupTags) || !configOptions.Inherits(SubscriptionTags) {
+		t.Errorf("InheritFrom = %v, want both sources", configOptions.InheritFrom)
+	}
+
+	_, err = NewConfigOptions(corev1.ConfigMap{Data: map[string]string{"inheritFrom": "resource-group,management-group,resource-group"}})
+	if err == nil || !strings.Contains(err.Error(), "data.inheritFrom[1]") || !strings.Contains(err.Error(), "data.inheritFrom[2]") {
+		t.Errorf("expected errors for the unknown and duplicate sources, got: %v", err)
+	}
+}
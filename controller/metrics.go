@@ -0,0 +1,18 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var filteredKeys = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tag_label_sync_filtered_keys_total",
+		Help: "Number of tag and label names left out of a sync by a key filter rule.",
+	},
+	[]string{"direction", "rule"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(filteredKeys)
+}
@@ -1,74 +1,296 @@
 package controller
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode/utf8"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	taglabelv1 "tag-label-sync.io/api/v1"
 )
 
 const (
-	maxTagNameLen     int    = 512
-	maxTagValLen      int    = 256
-	maxNumTags        int    = 50
-	invalidTagChars   string = "<>%&\\?/"
-	maxLabelNameLen   int    = 63
-	maxLabelPrefixLen int    = 253
-	maxLabelValLen    int    = 63
+	maxTagNameLen     int = 512
+	maxTagValLen      int = 256
+	maxNumTags        int = 50
+	maxLabelNameLen   int = 63
+	maxLabelPrefixLen int = 253
+	maxLabelValLen    int = 63
 )
 
-func ValidTagName(labelName string, configOptions ConfigOptions) bool {
-	return validTagName(labelWithoutPrefix(labelName, configOptions.LabelPrefix))
+// TagLimits are the limits a cloud puts on the tags of a resource. Labels and annotations that would
+// make a tag outside the limits aren't copied to the resource.
+type TagLimits struct {
+	MaxTags     int
+	MaxNameLen  int
+	MaxValueLen int
+	// ReservedPrefixes are the beginnings of tag names only the cloud itself can write, compared
+	// case-insensitively.
+	ReservedPrefixes []string
+	// Valid, if set, is any other check a tag must pass, e.g. on the characters it can have.
+	Valid func(tagName, tagVal string) bool
 }
 
-func ConvertTagNameToValidLabelName(tagName string, configOptions ConfigOptions) string {
-	// lstrip configOptions.TagPrefix if there
-	// don't forget to get rid of '.' after 'node.labels'... are there prefixes here?
-	result := tagName
-	if strings.HasPrefix(tagName, fmt.Sprintf("%s", configOptions.TagPrefix)) {
-		result = strings.TrimPrefix(tagName, fmt.Sprintf("%s", configOptions.TagPrefix))
+// AzureTagLimits are the limits on the tags of Azure resources.
+var AzureTagLimits = TagLimits{MaxTags: maxNumTags, MaxNameLen: maxTagNameLen, MaxValueLen: maxTagValLen}
+
+// tagLimitsRule is the rule reported for keys that would make a tag outside the resource's limits.
+const tagLimitsRule string = "tag limits"
+
+// allows is true if a tag with this name and value can be written.
+func (l TagLimits) allows(tagName, tagVal string) bool {
+	if len(tagName) > l.MaxNameLen || len(tagVal) > l.MaxValueLen {
+		return false
+	}
+	for _, prefix := range l.ReservedPrefixes {
+		if strings.HasPrefix(strings.ToLower(tagName), strings.ToLower(prefix)) {
+			return false
+		}
 	}
+	return l.Valid == nil || l.Valid(tagName, tagVal)
+}
 
-	// truncate name segment to 63 characters or less
-	if len(result) > maxLabelNameLen {
-		result = result[:maxLabelNameLen+1]
+// Names are mapped between ARM tags and node labels so that converting a name and back always gives
+// the name it started with:
+//
+// An ARM tag becomes a label under the label prefix, e.g. tag "Cost Center" becomes label
+// "azure.tags/Cost_20Center". Characters that can't be in a label name are written as '_' and two
+// hex digits per byte, and '_' itself as "__". A name that would otherwise start with anything but
+// a letter or a digit other than '0' is marked with a leading '0'.
+//
+// A node label outside the label prefix becomes a tag under the tag prefix, with '/' written as ':',
+// e.g. label "topology.kubernetes.io/zone" becomes tag "node.labels.topology.kubernetes.io:zone".
+// Without a tag prefix the two kinds of tag can't be told apart, so such a tag comes back as a label
+// under the label prefix.
+const (
+	escapeChar      byte   = '_'
+	leadingMarker   byte   = '0'
+	tagPrefixSep    string = "."
+	labelSlashInTag string = ":"
+)
+
+// A tag name or value too long for a label is cut short and ends with "_x" and a hash of the whole
+// name or value, so that long names with the same beginning don't collide. "_x" is never produced by
+// the escaping above, and the cut is never made inside an escape sequence, so a shortened name can't be
+// mistaken for an escaped one. The full name and value
+// are kept in the originals annotation so they can be restored when copying labels back to ARM.
+const (
+	shortenedMarker string = "_x"
+	hashLen         int    = 8
+)
+
+// ConvertTagNameToValidLabelName returns the label name for an ARM tag, and false if there is no
+// valid label name for it.
+func ConvertTagNameToValidLabelName(tagName string, configOptions ConfigOptions) (string, bool) {
+	if configOptions.TagPrefix != "" && strings.HasPrefix(tagName, configOptions.TagPrefix+tagPrefixSep) {
+		labelName := strings.Replace(strings.TrimPrefix(tagName, configOptions.TagPrefix+tagPrefixSep), labelSlashInTag, "/", -1)
+		// a tag that doesn't decode to a label outside the prefix wasn't made from a label, so treat it like any other tag
+		if validLabelName(labelName) && !hasLabelPrefix(labelName, configOptions.LabelPrefix) {
+			return labelName, true
+		}
 	}
 
-	// must begin and end with alphanumeric character with -,_,. and alphanumerics in between
+	labelName := labelWithPrefix(shorten(encodeLabelNameSegment(tagName), maxLabelNameLen), configOptions.LabelPrefix)
+	if !validLabelName(labelName) {
+		return "", false
+	}
+	return labelName, true
+}
 
-	// must have prefix
-	// prefix must not be longer than 253 characters
-	result = labelWithPrefix(result, configOptions.LabelPrefix)
-	return result
+// ConvertLabelNameToValidTagName returns the ARM tag name for a node label, and false if there is no
+// valid tag name for it.
+func ConvertLabelNameToValidTagName(labelName string, configOptions ConfigOptions) (string, bool) {
+	if hasLabelPrefix(labelName, configOptions.LabelPrefix) {
+		tagName, ok := decodeLabelNameSegment(labelWithoutPrefix(labelName, configOptions.LabelPrefix))
+		if !ok || !validTagName(tagName) {
+			return "", false
+		}
+		return tagName, true
+	}
+
+	tagName := strings.Replace(labelName, "/", labelSlashInTag, -1)
+	if configOptions.TagPrefix != "" {
+		tagName = configOptions.TagPrefix + tagPrefixSep + tagName
+	}
+	if !validTagName(tagName) {
+		return "", false
+	}
+	return tagName, true
+}
+
+// ConvertTagNameToValidAnnotationName returns the annotation name for an ARM tag, and false if there is
+// no valid annotation name for it. Names are converted as for labels, under the annotation prefix.
+func ConvertTagNameToValidAnnotationName(tagName string, configOptions ConfigOptions) (string, bool) {
+	annotationName := labelWithPrefix(shorten(encodeLabelNameSegment(tagName), maxLabelNameLen), configOptions.AnnotationPrefix)
+	if !validLabelName(annotationName) {
+		return "", false
+	}
+	return annotationName, true
 }
 
-func ConvertLabelNameToValidTagName(labelName string, configOptions ConfigOptions) string {
-	// get rid of '/' and other characters.
-	// also detect if 'azure.tags' is in the name to get rid of it? also get rid of '/' after 'azure.tags'
-	// don't add if label name is a truncated version of a tag
-	result := labelName
-	if strings.HasPrefix(labelName, fmt.Sprintf("%s/", configOptions.LabelPrefix)) {
-		result = strings.TrimPrefix(labelName, fmt.Sprintf("%s/", configOptions.LabelPrefix))
+// ConvertAnnotationNameToValidTagName returns the ARM tag name for a node annotation under the
+// annotation prefix, and false if there is no valid tag name for it.
+func ConvertAnnotationNameToValidTagName(annotationName string, configOptions ConfigOptions) (string, bool) {
+	if !hasLabelPrefix(annotationName, configOptions.AnnotationPrefix) {
+		return "", false
+	}
+	tagName, ok := decodeLabelNameSegment(labelWithoutPrefix(annotationName, configOptions.AnnotationPrefix))
+	if !ok || !validTagName(tagName) {
+		return "", false
 	}
+	return tagName, true
+}
 
-	if validTagName(result) {
-		// what now?
+// ConvertTagValToValidLabelVal returns the label value for an ARM tag value. Values with characters that
+// can't be in a label value are sanitized according to the value policy, and false is returned if the
+// policy is to skip them. Values that are too long are shortened whatever the policy.
+func ConvertTagValToValidLabelVal(tagVal string, configOptions ConfigOptions) (string, bool) {
+	labelVal := tagVal
+	if !validLabelValFormat(tagVal) {
+		switch configOptions.ValuePolicy {
+		case EscapeValue:
+			labelVal = encodeLabelValue(tagVal)
+		case SubstituteValue:
+			labelVal = substituteLabelValue(tagVal)
+		default:
+			return "", false
+		}
 	}
+	return shorten(labelVal, maxLabelValLen), true
+}
 
-	// result = tagWithPrefix(result, configOptions.TagPrefix)
-	return result
+func ConvertLabelValToValidTagVal() {
 }
 
-func ConvertTagValToValidLabelVal(tagVal string) string {
-	result := tagVal
-	if len(result) > maxLabelValLen {
-		result = result[:maxLabelValLen+1]
+// encodeLabelNameSegment escapes a tag name so it can be used as the name part of a label key.
+func encodeLabelNameSegment(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == escapeChar && i == len(name)-1:
+			// "__" can't end a label name, but the hex escape can
+			fmt.Fprintf(&b, "%c%02x", escapeChar, c)
+		case c == escapeChar:
+			b.WriteByte(escapeChar)
+			b.WriteByte(escapeChar)
+		case isAlphanumeric(c), (c == '-' || c == '.') && i != len(name)-1:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%c%02x", escapeChar, c)
+		}
+	}
+
+	result := b.String()
+	if result == "" || !isAlphanumeric(result[0]) || result[0] == leadingMarker {
+		result = string(leadingMarker) + result
 	}
 	return result
 }
 
-func ConvertLabelValToValidTagVal() {
+// decodeLabelNameSegment reverses encodeLabelNameSegment. It returns false for anything
+// encodeLabelNameSegment wouldn't have produced, so that each tag has exactly one label name.
+func decodeLabelNameSegment(segment string) (string, bool) {
+	encoded := segment
+	if strings.HasPrefix(encoded, string(leadingMarker)) {
+		encoded = encoded[1:]
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(encoded); i++ {
+		c := encoded[i]
+		if c != escapeChar {
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 < len(encoded) && encoded[i+1] == escapeChar {
+			b.WriteByte(escapeChar)
+			i++
+			continue
+		}
+		if i+2 >= len(encoded) {
+			return "", false
+		}
+		decoded, err := strconv.ParseUint(encoded[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", false
+		}
+		b.WriteByte(byte(decoded))
+		i += 2
+	}
+
+	name := b.String()
+	if !utf8.ValidString(name) || encodeLabelNameSegment(name) != segment {
+		return "", false
+	}
+	return name, true
+}
+
+// shorten cuts s to max bytes, replacing the end with a hash of all of s.
+func shorten(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	n := max - len(shortenedMarker) - hashLen
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	n -= partialEscapeLen(s[:n])
+	sum := sha256.Sum256([]byte(s))
+	return s[:n] + shortenedMarker + hex.EncodeToString(sum[:])[:hashLen]
+}
+
+// partialEscapeLen is the length of the escape sequence s ends part way through, if any, so that a cut
+// name doesn't end in a lone '_' that would make "__" with the shortened marker. Escape sequences are
+// read from the left, so an odd run of '_' ends in the start of a hex escape.
+func partialEscapeLen(s string) int {
+	oddRun := func(end int) bool {
+		run := 0
+		for end-run > 0 && s[end-run-1] == escapeChar {
+			run++
+		}
+		return run%2 == 1
+	}
+	switch {
+	case oddRun(len(s)):
+		return 1
+	case len(s) >= 2 && oddRun(len(s)-1):
+		return 2
+	}
+	return 0
+}
+
+// encodeLabelValue escapes a value the same way as a tag name in a label name.
+func encodeLabelValue(value string) string {
+	if value == "" {
+		return value
+	}
+	return encodeLabelNameSegment(value)
+}
+
+// substituteLabelValue replaces each character that can't be in a label value with '-', and drops
+// those at either end.
+func substituteLabelValue(value string) string {
+	result := strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && (isAlphanumeric(byte(r)) || r == '-' || r == '_' || r == '.') {
+			return r
+		}
+		return '-'
+	}, value)
+	return strings.TrimFunc(result, func(r rune) bool {
+		return r >= utf8.RuneSelf || !isAlphanumeric(byte(r))
+	})
 }
 
 func labelWithPrefix(labelName, prefix string) string {
+	if prefix == "" {
+		return labelName
+	}
 	return fmt.Sprintf("%s/%s", prefix, labelName)
 }
 
@@ -79,18 +301,26 @@ func labelWithoutPrefix(labelName, prefix string) string {
 	return labelName
 }
 
-// what character should I use?
-func tagWithPrefix(tagName, prefix string) string {
-	return fmt.Sprintf("%s-%s", prefix, tagName)
+func validLabelName(labelName string) bool {
+	return len(validation.IsQualifiedName(labelName)) == 0
 }
 
-func tagWithoutPrefix(tagName, prefix string) string {
-	return ""
+func validLabelVal(labelVal string) bool {
+	return len(validation.IsValidLabelValue(labelVal)) == 0
 }
 
-func validTagName(labelName string) bool {
-	if strings.ContainsAny(labelName, invalidTagChars) {
-		return false
-	}
-	return true
+// labelValFormat is the grammar of a label value without its length limit, which shorten takes care of.
+var labelValFormat = regexp.MustCompile(`^(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?$`)
+
+// validLabelValFormat is true if the value only needs shortening, if anything, to be a label value.
+func validLabelValFormat(labelVal string) bool {
+	return labelValFormat.MatchString(labelVal)
+}
+
+func validTagName(tagName string) bool {
+	return tagName != "" && len(tagName) <= maxTagNameLen && !strings.ContainsAny(tagName, taglabelv1.InvalidTagChars)
+}
+
+func isAlphanumeric(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
 }
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	taglabelv1 "tag-label-sync.io/api/v1"
+)
+
+func TestConvertTagNameToValidLabelName(t *testing.T) {
+	tests := []struct {
+		tagName string
+		want    string
+	}{
+		{tagName: "env", want: "azure.tags/env"},
+		{tagName: "Cost Center", want: "azure.tags/Cost_20Center"},
+		{tagName: "cost_center", want: "azure.tags/cost__center"},
+		{tagName: "trailing_", want: "azure.tags/trailing_5f"},
+		{tagName: "a:b", want: "azure.tags/a_3ab"},
+		{tagName: "-leading", want: "azure.tags/0-leading"},
+		{tagName: "0zero", want: "azure.tags/00zero"},
+		{tagName: "trailing.", want: "azure.tags/trailing_2e"},
+		{tagName: "node.labels.topology.kubernetes.io:zone", want: "topology.kubernetes.io/zone"},
+		{tagName: "node.labels.rack", want: "rack"},
+		// doesn't decode to a label outside the label prefix, so it's an ordinary tag
+		{tagName: "node.labels.azure.tags:env", want: "azure.tags/node.labels.azure.tags_3aenv"},
+	}
+
+	for _, tt := range tests {
+		got, ok := ConvertTagNameToValidLabelName(tt.tagName, DefaultConfigOptions())
+		if !ok || got != tt.want {
+			t.Errorf("ConvertTagNameToValidLabelName(%q) = %q, %v, want %q", tt.tagName, got, ok, tt.want)
+		}
+	}
+
+}
+
+func TestShortenedNames(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	first, ok := ConvertTagNameToValidLabelName(long+"1", DefaultConfigOptions())
+	if !ok {
+		t.Fatalf("expected a label name for a long tag name")
+	}
+	second, _ := ConvertTagNameToValidLabelName(long+"2", DefaultConfigOptions())
+	if first == second {
+		t.Errorf("long tag names with the same beginning got the same label name %q", first)
+	}
+	if len(labelWithoutPrefix(first, taglabelv1.DefaultLabelPrefix)) != maxLabelNameLen {
+		t.Errorf("label name %q should be shortened to %d characters", first, maxLabelNameLen)
+	}
+	if again, _ := ConvertTagNameToValidLabelName(long+"1", DefaultConfigOptions()); again != first {
+		t.Errorf("shortening is not deterministic: %q != %q", again, first)
+	}
+	// a shortened name never decodes to a tag name, only the originals annotation maps it back
+	if tagName, ok := ConvertLabelNameToValidTagName(first, DefaultConfigOptions()); ok {
+		t.Errorf("shortened label name %q decoded to tag name %q", first, tagName)
+	}
+
+	// wherever the cut falls in an escape sequence
+	for i := 40; i < 60; i++ {
+		for _, escaped := range []string{" ", "_", "__", " _"} {
+			tagName := strings.Repeat("a", i) + escaped + strings.Repeat("b", 40)
+			labelName, ok := ConvertTagNameToValidLabelName(tagName, DefaultConfigOptions())
+			if !ok {
+				t.Fatalf("expected a label name for %q", tagName)
+			}
+			if decoded, ok := ConvertLabelNameToValidTagName(labelName, DefaultConfigOptions()); ok {
+				t.Errorf("shortened label name %q of %q decoded to tag name %q", labelName, tagName, decoded)
+			}
+		}
+	}
+
+	if got, _ := ConvertTagValToValidLabelVal(long, DefaultConfigOptions()); len(got) != maxLabelValLen || !strings.HasPrefix(got, "aaaa") {
+		t.Errorf("ConvertTagValToValidLabelVal() = %q, want a shortened value", got)
+	}
+	if got, _ := ConvertTagValToValidLabelVal("short", DefaultConfigOptions()); got != "short" {
+		t.Errorf("ConvertTagValToValidLabelVal() = %q, want the value unchanged", got)
+	}
+}
+
+func TestConvertTagValToValidLabelVal(t *testing.T) {
+	// too long, but otherwise valid, so only shortened whatever the policy
+	long := strings.Repeat("x", 80)
+	longUnderscores := strings.Repeat("a_b", 30)
+	tests := []struct {
+		tagVal string
+		policy ValuePolicy
+		want   string
+		ok     bool
+	}{
+		{tagVal: "prod", policy: SkipValue, want: "prod", ok: true},
+		{tagVal: "", policy: SkipValue, want: "", ok: true},
+		{tagVal: "a_b", policy: EscapeValue, want: "a_b", ok: true}, // valid values are never escaped
+		{tagVal: "Jane Doe", policy: EscapeValue, want: "Jane_20Doe", ok: true},
+		{tagVal: "@team", policy: EscapeValue, want: "0_40team", ok: true},
+		{tagVal: "Jane Doe", policy: SubstituteValue, want: "Jane-Doe", ok: true},
+		{tagVal: "jane@example.com", policy: SubstituteValue, want: "jane-example.com", ok: true},
+		{tagVal: "/subscriptions/1234/", policy: SubstituteValue, want: "subscriptions-1234", ok: true},
+		{tagVal: "héllo", policy: SubstituteValue, want: "h-llo", ok: true},
+		{tagVal: "@@", policy: SubstituteValue, want: "", ok: true},
+		{tagVal: "Jane Doe", policy: SkipValue, ok: false},
+		{tagVal: long, policy: SkipValue, want: shorten(long, maxLabelValLen), ok: true},
+		{tagVal: long, policy: SubstituteValue, want: shorten(long, maxLabelValLen), ok: true},
+		{tagVal: longUnderscores, policy: EscapeValue, want: shorten(longUnderscores, maxLabelValLen), ok: true},
+		{tagVal: longUnderscores, policy: SkipValue, want: shorten(longUnderscores, maxLabelValLen), ok: true},
+	}
+
+	for _, tt := range tests {
+		options := DefaultConfigOptions()
+		options.ValuePolicy = tt.policy
+		got, ok := ConvertTagValToValidLabelVal(tt.tagVal, options)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ConvertTagValToValidLabelVal(%q, %s) = %q, %v, want %q, %v", tt.tagVal, tt.policy, got, ok, tt.want, tt.ok)
+		}
+		if ok && !validLabelVal(got) {
+			t.Errorf("ConvertTagValToValidLabelVal(%q, %s) = %q, which is not a valid label value", tt.tagVal, tt.policy, got)
+		}
+	}
+}
+
+func TestConvertLabelNameToValidTagName(t *testing.T) {
+	tests := []struct {
+		labelName string
+		want      string
+		ok        bool
+	}{
+		{labelName: "azure.tags/env", want: "env", ok: true},
+		{labelName: "azure.tags/Cost_20Center", want: "Cost Center", ok: true},
+		{labelName: "rack", want: "node.labels.rack", ok: true},
+		{labelName: "topology.kubernetes.io/zone", want: "node.labels.topology.kubernetes.io:zone", ok: true},
+		// not produced by the encoding, so they have no tag
+		{labelName: "azure.tags/cost_center", ok: false},
+		{labelName: "azure.tags/0env", ok: false},
+		{labelName: "azure.tags/a_2F", ok: false},
+		{labelName: "azure.tags/a_2f", ok: false}, // '/' can't be in a tag name
+	}
+
+	for _, tt := range tests {
+		got, ok := ConvertLabelNameToValidTagName(tt.labelName, DefaultConfigOptions())
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ConvertLabelNameToValidTagName(%q) = %q, %v, want %q, %v", tt.labelName, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNameRoundTrip(t *testing.T) {
+	emptyPrefixes := DefaultConfigOptions()
+	emptyPrefixes.LabelPrefix = ""
+	emptyPrefixes.TagPrefix = ""
+
+	tagNames := []string{"env", "Cost Center", "a_b", "_", "__x__", "0", "-", "a.b-c", "ünïcode", "x:y", "node.labels.foo bar"}
+	labelNames := []string{"rack", "topology.kubernetes.io/zone", "example.com/a_b-c.d", "0"}
+
+	for _, configOptions := range []ConfigOptions{DefaultConfigOptions(), emptyPrefixes} {
+		for _, tagName := range tagNames {
+			labelName, ok := ConvertTagNameToValidLabelName(tagName, configOptions)
+			if !ok {
+				t.Errorf("no label name for tag %q", tagName)
+				continue
+			}
+			if got, ok := ConvertLabelNameToValidTagName(labelName, configOptions); !ok || got != tagName {
+				t.Errorf("tag %q became label %q and then tag %q, %v", tagName, labelName, got, ok)
+			}
+		}
+		if configOptions.TagPrefix == "" {
+			// labels outside the label prefix can't be told apart from other tags without a tag prefix
+			continue
+		}
+		for _, labelName := range labelNames {
+			tagName, ok := ConvertLabelNameToValidTagName(labelName, configOptions)
+			if !ok {
+				t.Errorf("no tag name for label %q", labelName)
+				continue
+			}
+			if got, ok := ConvertTagNameToValidLabelName(tagName, configOptions); !ok || got != labelName {
+				t.Errorf("label %q became tag %q and then label %q, %v", labelName, tagName, got, ok)
+			}
+		}
+	}
+}
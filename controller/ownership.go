@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// LastAppliedAnnotation records on each node which labels, annotations, taints and tags the controller
+// created, like kubectl's last-applied-configuration. Without it there's no telling a label copied
+// from a tag that has since been deleted apart from a label someone set by hand.
+const LastAppliedAnnotation string = "tag-label-sync.io/last-applied"
+
+// OriginalsAnnotation records the full tag name and value for each label or annotation the controller
+// had to shorten, keyed by name, so the tag can be restored when the key is copied back to ARM.
+const OriginalsAnnotation string = "tag-label-sync.io/originals"
+
+// PropagatedAnnotation records the tags the controller copied to the resources attached to a node's
+// VM, and which resources they were copied to. It's kept apart from LastAppliedAnnotation because the
+// attached resources are written after the VM, and can fail on their own.
+const PropagatedAnnotation string = "tag-label-sync.io/propagated"
+
+// ManagedKeys are the names of the labels, annotations, taints and tags created by the controller.
+type ManagedKeys struct {
+	Labels      []string `json:"labels,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+	Taints      []string `json:"taints,omitempty"` // key and effect, e.g. "dedicated:NoSchedule"
+	Tags        []string `json:"tags,omitempty"`
+}
+
+func (m ManagedKeys) empty() bool {
+	return len(m.Labels) == 0 && len(m.Annotations) == 0 && len(m.Taints) == 0 && len(m.Tags) == 0
+}
+
+// Original is the tag a label or annotation was copied from, for those whose name or value had to be changed.
+// Only the parts that were changed are set.
+type Original struct {
+	Tag   string `json:"tag,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// Propagated is what was last copied to the resources attached to a node's VM. Tags that are no
+// longer synced are removed from the attached resources because they're in here, so they're removed
+// even if the VM's own tags were updated in an earlier sync whose propagation failed.
+type Propagated struct {
+	Tags map[string]string `json:"tags,omitempty"`
+	// Resources are the IDs of the resources the tags were written to, sorted. They're left out while
+	// tags are being added, so a propagation that didn't finish never looks in sync.
+	Resources []string `json:"resources,omitempty"`
+}
+
+func (p Propagated) empty() bool {
+	return len(p.Tags) == 0 && len(p.Resources) == 0
+}
+
+// inSync is true if the same tags were written to the same resources.
+func (p Propagated) inSync(other Propagated) bool {
+	if len(p.Tags) != len(other.Tags) || len(p.Resources) != len(other.Resources) {
+		return false
+	}
+	for k, v := range p.Tags {
+		if otherVal, ok := other.Tags[k]; !ok || otherVal != v {
+			return false
+		}
+	}
+	for i := range p.Resources {
+		if p.Resources[i] != other.Resources[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// managedKeys reads the keys recorded on the node. A missing annotation means nothing is managed yet.
+func managedKeys(node *corev1.Node) (ManagedKeys, error) {
+	managed := ManagedKeys{}
+	annotation, ok := node.Annotations[LastAppliedAnnotation]
+	if !ok || annotation == "" {
+		return managed, nil
+	}
+	if err := json.Unmarshal([]byte(annotation), &managed); err != nil {
+		return ManagedKeys{}, err
+	}
+	return managed, nil
+}
+
+// originals reads the originals recorded on the node. A missing annotation means there are none.
+func originals(node *corev1.Node) (map[string]Original, error) {
+	annotation, ok := node.Annotations[OriginalsAnnotation]
+	if !ok || annotation == "" {
+		return nil, nil
+	}
+	result := map[string]Original{}
+	if err := json.Unmarshal([]byte(annotation), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// propagated reads the record of propagated tags on the node. A missing annotation means nothing was
+// propagated yet.
+func propagated(node *corev1.Node) (Propagated, error) {
+	annotation, ok := node.Annotations[PropagatedAnnotation]
+	if !ok || annotation == "" {
+		return Propagated{}, nil
+	}
+	result := Propagated{}
+	if err := json.Unmarshal([]byte(annotation), &result); err != nil {
+		return Propagated{}, err
+	}
+	return result, nil
+}
+
+// lastAppliedAnnotation returns the new annotation value for the node, or nil if it should be removed.
+// changed is false if the node already has that value.
+func lastAppliedAnnotation(node *corev1.Node, managed ManagedKeys) (value *string, changed bool, err error) {
+	return jsonAnnotation(node, LastAppliedAnnotation, managed, managed.empty())
+}
+
+// originalsAnnotation is like lastAppliedAnnotation for OriginalsAnnotation.
+func originalsAnnotation(node *corev1.Node, originals map[string]Original) (value *string, changed bool, err error) {
+	return jsonAnnotation(node, OriginalsAnnotation, originals, len(originals) == 0)
+}
+
+// propagatedAnnotation is like lastAppliedAnnotation for PropagatedAnnotation.
+func propagatedAnnotation(node *corev1.Node, record Propagated) (value *string, changed bool, err error) {
+	return jsonAnnotation(node, PropagatedAnnotation, record, record.empty())
+}
+
+func jsonAnnotation(node *corev1.Node, key string, v interface{}, empty bool) (*string, bool, error) {
+	current, ok := node.Annotations[key]
+	if empty {
+		return nil, ok, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false, err
+	}
+	annotation := string(data)
+	return &annotation, !ok || current != annotation, nil
+}
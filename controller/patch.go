@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type metadataPatch struct {
+	Labels      map[string]*string `json:"labels,omitempty"`
+	Annotations map[string]*string `json:"annotations,omitempty"`
+	// ResourceVersion makes the patch fail if the node changed since it was read
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type specPatch struct {
+	Taints []corev1.Taint `json:"taints"`
+}
+
+type nodePatch struct {
+	Metadata metadataPatch `json:"metadata"`
+	Spec     *specPatch    `json:"spec,omitempty"`
+}
+
+// labelPatch builds a strategic merge patch with every label, annotation and taint change in the
+// plan, and the keys the controller manages and the originals of shortened labels afterwards. Only
+// keys under the configured label and annotation prefixes are included, so the controller can't
+// clobber keys that belong to kubelet or other controllers. Returns nil if there is nothing to patch.
+func labelPatch(node *corev1.Node, plan SyncPlan, configOptions ConfigOptions) ([]byte, error) {
+	labels := map[string]*string{}
+	for _, changes := range []map[string]string{plan.LabelsToAdd, plan.LabelsToUpdate} {
+		for labelName, labelVal := range changes {
+			if hasLabelPrefix(labelName, configOptions.LabelPrefix) {
+				val := labelVal
+				labels[labelName] = &val
+			}
+		}
+	}
+	for _, labelName := range plan.LabelsToRemove {
+		if hasLabelPrefix(labelName, configOptions.LabelPrefix) {
+			labels[labelName] = nil // null removes the key
+		}
+	}
+
+	annotations := map[string]*string{}
+	for _, changes := range []map[string]string{plan.AnnotationsToAdd, plan.AnnotationsToUpdate} {
+		for annotationName, annotationVal := range changes {
+			if hasLabelPrefix(annotationName, configOptions.AnnotationPrefix) {
+				val := annotationVal
+				annotations[annotationName] = &val
+			}
+		}
+	}
+	for _, annotationName := range plan.AnnotationsToRemove {
+		if hasLabelPrefix(annotationName, configOptions.AnnotationPrefix) {
+			annotations[annotationName] = nil
+		}
+	}
+	lastApplied, changed, err := lastAppliedAnnotation(node, plan.Managed)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		annotations[LastAppliedAnnotation] = lastApplied
+	}
+	originals, changed, err := originalsAnnotation(node, plan.Originals)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		annotations[OriginalsAnnotation] = originals
+	}
+
+	if len(labels) == 0 && len(annotations) == 0 && !plan.TaintsChanged() {
+		return nil, nil
+	}
+
+	patch := nodePatch{Metadata: metadataPatch{Labels: labels, Annotations: annotations}}
+	if plan.TaintsChanged() {
+		// taints are replaced as a whole, so make sure none were added since the node was read
+		patch.Metadata.ResourceVersion = node.ResourceVersion
+		patch.Spec = &specPatch{Taints: plan.Taints}
+	}
+	return json.Marshal(patch)
+}
+
+// patchNodeLabels applies the plan's label, annotation and taint changes to the node in a single patch.
+// The keys the controller manages are recorded in the same patch. Label and annotation changes are
+// merged into whatever the node has by then, so they can't conflict; a patch that replaces the taints
+// returns a conflict if the node changed, and has to be planned again from the node as it is now.
+func (r *ReconcileTagLabelSync) patchNodeLabels(node *corev1.Node, plan SyncPlan, configOptions ConfigOptions) error {
+	patch, err := labelPatch(node, plan, configOptions)
+	if err != nil {
+		return err
+	}
+	if patch == nil {
+		return nil
+	}
+	return r.Patch(r.ctx, node, client.ConstantPatch(types.StrategicMergePatchType, patch))
+}
+
+// patchPropagated records on the node what was propagated to the resources attached to its VM, unless
+// the node already has that record.
+func (r *ReconcileTagLabelSync) patchPropagated(node *corev1.Node, record Propagated) error {
+	value, changed, err := propagatedAnnotation(node, record)
+	if err != nil || !changed {
+		return err
+	}
+	patch, err := json.Marshal(nodePatch{Metadata: metadataPatch{Annotations: map[string]*string{PropagatedAnnotation: value}}})
+	if err != nil {
+		return err
+	}
+	return r.Patch(r.ctx, node, client.ConstantPatch(types.StrategicMergePatchType, patch))
+}
+
+func hasLabelPrefix(labelName, prefix string) bool {
+	if prefix == "" {
+		return !strings.Contains(labelName, "/")
+	}
+	return strings.HasPrefix(labelName, fmt.Sprintf("%s/", prefix))
+}
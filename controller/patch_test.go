@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestLabelPatch(t *testing.T) {
+	plan := SyncPlan{
+		LabelsToAdd:    map[string]string{"azure.tags/env": "prod", "kubernetes.io/os": "linux"},
+		LabelsToUpdate: map[string]string{"azure.tags/team": "infra"},
+		LabelsToRemove: []string{"azure.tags/old", "agentpool"},
+	}
+
+	node := &corev1.Node{}
+
+	patch, err := labelPatch(node, plan, DefaultConfigOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"metadata":{"labels":{"azure.tags/env":"prod","azure.tags/old":null,"azure.tags/team":"infra"}}}`
+	if string(patch) != want {
+		t.Errorf("labelPatch() = %s, want %s", patch, want)
+	}
+
+	patch, err = labelPatch(node, SyncPlan{}, DefaultConfigOptions())
+	if err != nil || patch != nil {
+		t.Errorf("labelPatch() of empty plan = %s, %v, want nil", patch, err)
+	}
+}
+
+func TestLabelPatchLastApplied(t *testing.T) {
+	managed := ManagedKeys{Labels: []string{"azure.tags/env"}}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{LastAppliedAnnotation: `{"labels":["azure.tags/env"]}`},
+	}}
+
+	patch, err := labelPatch(node, SyncPlan{Managed: managed}, DefaultConfigOptions())
+	if err != nil || patch != nil {
+		t.Errorf("labelPatch() with unchanged managed keys = %s, %v, want nil", patch, err)
+	}
+
+	patch, err = labelPatch(node, SyncPlan{LabelsToRemove: []string{"azure.tags/env"}}, DefaultConfigOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"metadata":{"labels":{"azure.tags/env":null},"annotations":{"tag-label-sync.io/last-applied":null}}}`
+	if string(patch) != want {
+		t.Errorf("labelPatch() = %s, want %s", patch, want)
+	}
+
+	managed, err = managedKeys(node)
+	if err != nil || len(managed.Labels) != 1 || managed.Labels[0] != "azure.tags/env" {
+		t.Errorf("managedKeys() = %+v, %v", managed, err)
+	}
+}
+
+func TestLabelPatchOriginals(t *testing.T) {
+	node := &corev1.Node{}
+	plan := SyncPlan{
+		LabelsToAdd: map[string]string{"azure.tags/long": "short"},
+		Managed:     ManagedKeys{Labels: []string{"azure.tags/long"}},
+		Originals:   map[string]Original{"azure.tags/long": {Value: "the full value"}},
+	}
+
+	patch, err := labelPatch(node, plan, DefaultConfigOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"metadata":{"labels":{"azure.tags/long":"short"},"annotations":{"tag-label-sync.io/last-applied":"{\"labels\":[\"azure.tags/long\"]}","tag-label-sync.io/originals":"{\"azure.tags/long\":{\"value\":\"the full value\"}}"}}}`
+	if string(patch) != want {
+		t.Errorf("labelPatch() = %s, want %s", patch, want)
+	}
+
+	node.Annotations = map[string]string{OriginalsAnnotation: `{"azure.tags/long":{"value":"the full value"}}`}
+	got, err := originals(node)
+	if err != nil || !reflect.DeepEqual(got, plan.Originals) {
+		t.Errorf("originals() = %v, %v, want %v", got, err, plan.Originals)
+	}
+}
+
+func TestLabelPatchAnnotations(t *testing.T) {
+	plan := SyncPlan{
+		AnnotationsToAdd:    map[string]string{"azure.tags/owner": "jane@example.com", "cluster-autoscaler.kubernetes.io/scale-down-disabled": "true"},
+		AnnotationsToRemove: []string{"azure.tags/old"},
+	}
+
+	patch, err := labelPatch(&corev1.Node{}, plan, DefaultConfigOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"metadata":{"annotations":{"azure.tags/old":null,"azure.tags/owner":"jane@example.com"}}}`
+	if string(patch) != want {
+		t.Errorf("labelPatch() = %s, want %s", patch, want)
+	}
+}
+
+func TestLabelPatchTaints(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "42"}}
+	plan := SyncPlan{Taints: []corev1.Taint{}}
+
+	patch, err := labelPatch(node, plan, DefaultConfigOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"metadata":{"resourceVersion":"42"},"spec":{"taints":[]}}`
+	if string(patch) != want {
+		t.Errorf("labelPatch() = %s, want %s", patch, want)
+	}
+}
+
+// conflictingClient fails the first patches with a conflict, as if the node changed after it was read.
+type conflictingClient struct {
+	client.Client
+	conflicts int
+	patches   int
+}
+
+func (c *conflictingClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOptionFunc) error {
+	c.patches++
+	if c.patches <= c.conflicts {
+		node := obj.(*corev1.Node)
+		return apierrors.NewConflict(corev1.Resource("nodes"), node.Name, errors.New("the object has been modified"))
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestReconcileRetriesPatchOnConflict(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-0"},
+		Spec:       corev1.NodeSpec{ProviderID: "fake://node-0"},
+	}
+	provider := &fakeTagProvider{tags: map[string]map[string]string{"fake://node-0": {"env": "prod"}}}
+	r := newTestReconciler(node)
+	r.Providers = map[string]TagProvider{"fake": provider}
+	c := &conflictingClient{Client: r.Client, conflicts: 2}
+	r.Client = c
+
+	if _, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "node-0"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.patches != 3 {
+		t.Errorf("patched %d times, want 3", c.patches)
+	}
+	var got corev1.Node
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "node-0"}, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Labels["azure.tags/env"] != "prod" {
+		t.Errorf("labels = %v, want azure.tags/env=prod", got.Labels)
+	}
+}
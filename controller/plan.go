@@ -0,0 +1,548 @@
+package controller
+
+import (
+	"errors"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SyncState is what the planner needs to know about a node and the ARM resource backing it.
+type SyncState struct {
+	Labels      map[string]string
+	Annotations map[string]string
+	Taints      []corev1.Taint
+	Tags        map[string]string
+	// InheritedTags are read but never written, e.g. the tags of a scale set when syncing one of
+	// its VMs, or of the resource group. Tags with the same name take precedence over inherited ones.
+	InheritedTags map[string]string
+	// Managed is what the controller created on the last sync, as recorded on the node.
+	Managed ManagedKeys
+	// Originals is the full tag name and value of labels and annotations that had to be shortened or
+	// sanitized, as recorded on the node.
+	Originals map[string]Original
+	// Shared is set when the resource backs more than one node, e.g. a scale set. Tags on a shared
+	// resource are never removed, since another node may still have the label they came from.
+	Shared bool
+	// Limits are the resource's tag limits. Azure's apply if unset.
+	Limits TagLimits
+}
+
+// effectiveTags is the tags that apply to the resource, including inherited ones.
+func (s SyncState) effectiveTags() map[string]string {
+	tags := make(map[string]string, len(s.InheritedTags)+len(s.Tags))
+	for k, v := range s.InheritedTags {
+		tags[k] = v
+	}
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// limits returns the resource's tag limits, or Azure's if they're unset.
+func (s SyncState) limits() TagLimits {
+	if s.Limits.MaxTags == 0 {
+		return AzureTagLimits
+	}
+	return s.Limits
+}
+
+// Conflict is a tag/label pair with different values that a plan leaves unchanged.
+type Conflict struct {
+	Direction SyncDirection // direction in which the value was not applied
+	Target    TargetKind    // whether LabelName and LabelVal are a label, an annotation or a taint
+	TagName   string
+	TagVal    string
+	LabelName string
+	LabelVal  string
+}
+
+// SanitizedValue is a tag whose value isn't a valid label value, and what the value policy made of it.
+type SanitizedValue struct {
+	TagName   string
+	TagVal    string
+	LabelName string
+	LabelVal  string // empty if Skipped
+	Skipped   bool   // the tag isn't copied to the node
+}
+
+// SyncPlan is the set of label and tag changes needed to sync a node with its ARM resource.
+// Computing a plan has no side effects, so it can be applied with one node write and one ARM write.
+type SyncPlan struct {
+	LabelsToAdd    map[string]string
+	LabelsToUpdate map[string]string
+	LabelsToRemove []string
+	// AnnotationsToAdd, AnnotationsToUpdate and AnnotationsToRemove are nil unless tags are copied to
+	// annotations.
+	AnnotationsToAdd    map[string]string
+	AnnotationsToUpdate map[string]string
+	AnnotationsToRemove []string
+	// Taints is the node's taints once the plan is applied, or nil if they don't change.
+	Taints       []corev1.Taint
+	TagsToAdd    map[string]string
+	TagsToUpdate map[string]string
+	TagsToRemove []string
+	Conflicts    []Conflict
+	// Filtered is the keys left out by the configured key filters.
+	Filtered []FilteredKey
+	// Sanitized is the tags whose values aren't valid label values.
+	Sanitized []SanitizedValue
+	// InvalidTaints is the tags under the taint tag prefix that don't describe a valid taint.
+	InvalidTaints []InvalidTaintTag
+	// Managed is what the controller will have created once the plan is applied.
+	Managed ManagedKeys
+	// Originals is the full tag name and value of the managed labels and annotations that had to be
+	// shortened or sanitized.
+	Originals map[string]Original
+}
+
+func newSyncPlan() SyncPlan {
+	return SyncPlan{
+		LabelsToAdd:    map[string]string{},
+		LabelsToUpdate: map[string]string{},
+		TagsToAdd:      map[string]string{},
+		TagsToUpdate:   map[string]string{},
+	}
+}
+
+// nodeKeys is the state of one kind of node key, labels or annotations, while a plan is computed.
+type nodeKeys struct {
+	kind       TargetKind
+	current    map[string]string
+	managed    map[string]bool
+	newManaged map[string]bool
+	sourced    map[string]bool // keys copied from a tag in this plan
+	add        map[string]string
+	update     map[string]string
+	remove     []string
+}
+
+func newNodeKeys(kind TargetKind, current map[string]string, managed []string, add, update map[string]string) *nodeKeys {
+	return &nodeKeys{
+		kind:       kind,
+		current:    current,
+		managed:    toSet(managed),
+		newManaged: map[string]bool{},
+		sourced:    map[string]bool{},
+		add:        add,
+		update:     update,
+	}
+}
+
+// applied returns the keys as they will be once the plan is applied.
+func (k *nodeKeys) applied() map[string]string {
+	return applyChanges(k.current, k.add, k.update, k.remove)
+}
+
+// ComputeSyncPlan works out which labels, annotations and tags need to change for the given state and
+// options. Tags are filtered by name before being copied to the node, and labels and annotations before
+// being copied to ARM. A key the controller created is removed once the key it was copied from is gone,
+// and is never copied back the other way in two-way mode.
+func ComputeSyncPlan(state SyncState, configOptions ConfigOptions) (SyncPlan, error) {
+	tagFilter, err := compileKeyFilter(configOptions.TagFilter)
+	if err != nil {
+		return SyncPlan{}, err
+	}
+	labelFilter, err := compileKeyFilter(configOptions.LabelFilter)
+	if err != nil {
+		return SyncPlan{}, err
+	}
+	annotationTags, err := compilePatterns(configOptions.AnnotationTags)
+	if err != nil {
+		return SyncPlan{}, err
+	}
+	toAnnotation := func(tagName string) bool {
+		return configOptions.TargetKind == AnnotationTarget || matchesAny(annotationTags, tagName)
+	}
+
+	plan := newSyncPlan()
+	limits := state.limits()
+	conflicted := map[string]bool{}
+	tags := state.effectiveTags()
+	managedTags := toSet(state.Managed.Tags)
+	newManagedTags := map[string]bool{}
+	labels := newNodeKeys(LabelTarget, state.Labels, state.Managed.Labels, plan.LabelsToAdd, plan.LabelsToUpdate)
+	annotations := newNodeKeys(AnnotationTarget, state.Annotations, state.Managed.Annotations, map[string]string{}, map[string]string{})
+	desiredTaints := map[string]corev1.Taint{}
+	taintTags := map[string]string{}
+	managedTaints := toSet(state.Managed.Taints)
+	newManagedTaints := map[string]bool{}
+	originals := map[string]Original{}
+	manage := func(keys *nodeKeys, key string, original Original) {
+		keys.newManaged[key] = true
+		if original != (Original{}) {
+			originals[key] = original
+		}
+	}
+
+	if configOptions.SyncDirection == TwoWay || configOptions.SyncDirection == ARMToNode {
+		for _, tagName := range sortedKeys(tags) {
+			tagVal := tags[tagName]
+			if _, own := state.Tags[tagName]; own && managedTags[tagName] {
+				// copied from a node label, so don't copy it back
+				continue
+			}
+			if rule := tagFilter.rejects(tagName); rule != "" {
+				plan.Filtered = append(plan.Filtered, FilteredKey{Direction: ARMToNode, Key: tagName, Rule: rule})
+				continue
+			}
+			if isTaintTag(tagName, configOptions) {
+				taint, err := tagToTaint(tagName, tagVal, configOptions)
+				if err != nil {
+					plan.InvalidTaints = append(plan.InvalidTaints, InvalidTaintTag{TagName: tagName, TagVal: tagVal, Reason: err.Error()})
+					continue
+				}
+				desiredTaints[taintID(taint)] = taint
+				taintTags[taintID(taint)] = tagName
+				continue
+			}
+			labelName, ok := ConvertTagNameToValidLabelName(tagName, configOptions)
+			if ok && !hasLabelPrefix(labelName, configOptions.LabelPrefix) {
+				// tags made from labels outside the prefix are never copied back to nodes
+				continue
+			}
+
+			keys, key, newVal := labels, labelName, tagVal
+			if toAnnotation(tagName) {
+				keys = annotations
+				if key, ok = ConvertTagNameToValidAnnotationName(tagName, configOptions); !ok {
+					continue
+				}
+			} else {
+				if !ok {
+					continue
+				}
+				newVal, ok = ConvertTagValToValidLabelVal(tagVal, configOptions)
+				if !validLabelValFormat(tagVal) {
+					plan.Sanitized = append(plan.Sanitized, SanitizedValue{TagName: tagName, TagVal: tagVal, LabelName: labelName, LabelVal: newVal, Skipped: !ok})
+				}
+				if !ok {
+					continue
+				}
+			}
+
+			keys.sourced[key] = true
+			original := originalTag(tagName, tagVal, keys.kind, key, newVal, configOptions)
+			val, ok := keys.current[key]
+			if !ok {
+				keys.add[key] = newVal
+				manage(keys, key, original)
+			} else if val == newVal {
+				manage(keys, key, original)
+			} else if keys.managed[key] {
+				// the tag changed since the key was copied
+				keys.update[key] = newVal
+				manage(keys, key, original)
+			} else {
+				switch configOptions.ConflictPolicy {
+				case ARMPrecedence:
+					keys.update[key] = newVal
+					manage(keys, key, original)
+				case NodePrecedence, Ignore:
+					plan.Conflicts = append(plan.Conflicts, Conflict{
+						Direction: ARMToNode,
+						Target:    keys.kind,
+						TagName:   tagName,
+						TagVal:    tagVal,
+						LabelName: key,
+						LabelVal:  val,
+					})
+					conflicted[tagName] = true
+				default:
+					return SyncPlan{}, errors.New("unrecognized conflict policy")
+				}
+			}
+		}
+		for _, keys := range []*nodeKeys{labels, annotations} {
+			for _, key := range sortedKeys(keys.current) {
+				if keys.managed[key] && !keys.sourced[key] {
+					keys.remove = append(keys.remove, key)
+				}
+			}
+		}
+		taints, managed, conflicts, changed := planTaints(state.Taints, managedTaints, desiredTaints, taintTags)
+		if changed {
+			plan.Taints = taints
+		}
+		newManagedTaints = managed
+		plan.Conflicts = append(plan.Conflicts, conflicts...)
+	} else {
+		// not syncing tags to the node, but still remember which keys came from tags
+		for _, keys := range []*nodeKeys{labels, annotations} {
+			for key := range keys.managed {
+				if _, ok := keys.current[key]; ok {
+					manage(keys, key, state.Originals[key])
+				}
+			}
+		}
+		for _, taint := range state.Taints {
+			if managedTaints[taintID(taint)] {
+				newManagedTaints[taintID(taint)] = true
+			}
+		}
+	}
+	plan.LabelsToRemove = labels.remove
+
+	if configOptions.SyncDirection == TwoWay || configOptions.SyncDirection == NodeToARM {
+		sourced := map[string]bool{}
+		copyToTag := func(tagName, value string, keys *nodeKeys, key string) error {
+			if sourced[tagName] || isTaintTag(tagName, configOptions) {
+				return nil
+			}
+			sourced[tagName] = true
+			if !limits.allows(tagName, value) {
+				plan.Filtered = append(plan.Filtered, FilteredKey{Direction: NodeToARM, Key: key, Rule: tagLimitsRule})
+				return nil
+			}
+			tagVal, ok := tags[tagName]
+			_, own := state.Tags[tagName]
+			if !ok {
+				if len(state.Tags)+len(plan.TagsToAdd) >= limits.MaxTags {
+					plan.Filtered = append(plan.Filtered, FilteredKey{Direction: NodeToARM, Key: key, Rule: tagLimitsRule})
+					return nil
+				}
+				plan.TagsToAdd[tagName] = value
+				newManagedTags[tagName] = true
+			} else if tagVal == value {
+				if own && managedTags[tagName] {
+					newManagedTags[tagName] = true
+				}
+			} else if own && managedTags[tagName] {
+				// the label changed since the tag was copied
+				plan.TagsToUpdate[tagName] = value
+				newManagedTags[tagName] = true
+			} else {
+				switch configOptions.ConflictPolicy {
+				case NodePrecedence:
+					if own {
+						plan.TagsToUpdate[tagName] = value
+						newManagedTags[tagName] = true
+					} else if len(state.Tags)+len(plan.TagsToAdd) < limits.MaxTags {
+						// override the inherited value on this resource only
+						plan.TagsToAdd[tagName] = value
+						newManagedTags[tagName] = true
+					} else {
+						plan.Filtered = append(plan.Filtered, FilteredKey{Direction: NodeToARM, Key: key, Rule: tagLimitsRule})
+					}
+				case ARMPrecedence, Ignore:
+					if conflicted[tagName] {
+						return nil
+					}
+					plan.Conflicts = append(plan.Conflicts, Conflict{
+						Direction: NodeToARM,
+						Target:    keys.kind,
+						TagName:   tagName,
+						TagVal:    tagVal,
+						LabelName: key,
+						LabelVal:  value,
+					})
+				default:
+					return errors.New("unrecognized conflict policy")
+				}
+			}
+			return nil
+		}
+
+		// compare against the keys as they will be once this plan is applied, so that
+		// a tag just copied to the node isn't seen as a new label in two-way mode
+		nodeLabels := labels.applied()
+		for _, labelName := range sortedKeys(nodeLabels) {
+			if labels.newManaged[labelName] {
+				continue
+			}
+			if rule := labelFilter.rejects(labelName); rule != "" {
+				plan.Filtered = append(plan.Filtered, FilteredKey{Direction: NodeToARM, Key: labelName, Rule: rule})
+				continue
+			}
+			tagName, labelVal, ok := labelToTag(labelName, nodeLabels[labelName], state.Originals, configOptions)
+			if !ok {
+				continue
+			}
+			if err := copyToTag(tagName, labelVal, labels, labelName); err != nil {
+				return SyncPlan{}, err
+			}
+		}
+		// annotations are only copied to ARM when tags are copied to annotations, and only those under
+		// the annotation prefix, since most annotations belong to Kubernetes or other controllers
+		if configOptions.TargetKind == AnnotationTarget || len(annotationTags) > 0 {
+			nodeAnnotations := annotations.applied()
+			for _, annotationName := range sortedKeys(nodeAnnotations) {
+				if annotations.newManaged[annotationName] || !hasLabelPrefix(annotationName, configOptions.AnnotationPrefix) {
+					continue
+				}
+				if rule := labelFilter.rejects(annotationName); rule != "" {
+					plan.Filtered = append(plan.Filtered, FilteredKey{Direction: NodeToARM, Key: annotationName, Rule: rule})
+					continue
+				}
+				tagName, ok := annotationToTag(annotationName, state.Originals, configOptions)
+				annotationVal := nodeAnnotations[annotationName]
+				if !ok {
+					continue
+				}
+				if err := copyToTag(tagName, annotationVal, annotations, annotationName); err != nil {
+					return SyncPlan{}, err
+				}
+			}
+		}
+		for _, tagName := range sortedKeys(state.Tags) {
+			if !managedTags[tagName] || sourced[tagName] {
+				continue
+			}
+			if state.Shared {
+				newManagedTags[tagName] = true
+				continue
+			}
+			plan.TagsToRemove = append(plan.TagsToRemove, tagName)
+		}
+	} else {
+		for tagName := range managedTags {
+			if _, ok := state.Tags[tagName]; ok {
+				newManagedTags[tagName] = true
+			}
+		}
+	}
+
+	if len(annotations.add) > 0 || len(annotations.update) > 0 || len(annotations.remove) > 0 {
+		plan.AnnotationsToAdd = annotations.add
+		plan.AnnotationsToUpdate = annotations.update
+		plan.AnnotationsToRemove = annotations.remove
+	}
+	plan.Managed = ManagedKeys{
+		Labels:      sortedSet(labels.newManaged),
+		Annotations: sortedSet(annotations.newManaged),
+		Taints:      sortedSet(newManagedTaints),
+		Tags:        sortedSet(newManagedTags),
+	}
+	if len(originals) > 0 {
+		plan.Originals = originals
+	}
+	return plan, nil
+}
+
+// originalTag returns what has to be recorded to get the tag back from its label or annotation, if the
+// name or value had to be changed.
+func originalTag(tagName, tagVal string, kind TargetKind, key, val string, configOptions ConfigOptions) Original {
+	original := Original{}
+	decoded, ok := ConvertLabelNameToValidTagName(key, configOptions)
+	if kind == AnnotationTarget {
+		decoded, ok = ConvertAnnotationNameToValidTagName(key, configOptions)
+	}
+	if !ok || decoded != tagName {
+		original.Tag = tagName
+	}
+	if val != tagVal {
+		original.Value = tagVal
+	}
+	return original
+}
+
+// labelToTag returns the tag name and value for a label. Shortened labels are mapped back to the full tag
+// name, and to the full value as long as the label still has the value the controller gave it.
+func labelToTag(labelName, labelVal string, originals map[string]Original, configOptions ConfigOptions) (string, string, bool) {
+	tagName, ok := ConvertLabelNameToValidTagName(labelName, configOptions)
+	original, found := originals[labelName]
+	if !found {
+		return tagName, labelVal, ok
+	}
+	if original.Tag != "" {
+		tagName, ok = original.Tag, true
+	}
+	if original.Value != "" {
+		if converted, ok := ConvertTagValToValidLabelVal(original.Value, configOptions); ok && labelVal == converted {
+			labelVal = original.Value
+		}
+	}
+	return tagName, labelVal, ok
+}
+
+// annotationToTag returns the tag name for an annotation, mapping shortened annotations back to the full
+// tag name. Annotation values are copied unchanged, so they need no mapping.
+func annotationToTag(annotationName string, originals map[string]Original, configOptions ConfigOptions) (string, bool) {
+	if original := originals[annotationName]; original.Tag != "" {
+		return original.Tag, true
+	}
+	return ConvertAnnotationNameToValidTagName(annotationName, configOptions)
+}
+
+// LabelsChanged is true if applying the plan changes the node's labels.
+func (p SyncPlan) LabelsChanged() bool {
+	return len(p.LabelsToAdd) > 0 || len(p.LabelsToUpdate) > 0 || len(p.LabelsToRemove) > 0
+}
+
+// AnnotationsChanged is true if applying the plan changes the node's annotations, other than those
+// the controller keeps its own records in.
+func (p SyncPlan) AnnotationsChanged() bool {
+	return len(p.AnnotationsToAdd) > 0 || len(p.AnnotationsToUpdate) > 0 || len(p.AnnotationsToRemove) > 0
+}
+
+// TaintsChanged is true if applying the plan changes the node's taints.
+func (p SyncPlan) TaintsChanged() bool {
+	return p.Taints != nil
+}
+
+// TagsChanged is true if applying the plan changes the ARM resource's tags.
+func (p SyncPlan) TagsChanged() bool {
+	return len(p.TagsToAdd) > 0 || len(p.TagsToUpdate) > 0 || len(p.TagsToRemove) > 0
+}
+
+// ApplyToLabels returns a copy of labels with the plan's label changes applied.
+func (p SyncPlan) ApplyToLabels(labels map[string]string) map[string]string {
+	return applyChanges(labels, p.LabelsToAdd, p.LabelsToUpdate, p.LabelsToRemove)
+}
+
+// ApplyToAnnotations returns a copy of annotations with the plan's annotation changes applied.
+func (p SyncPlan) ApplyToAnnotations(annotations map[string]string) map[string]string {
+	return applyChanges(annotations, p.AnnotationsToAdd, p.AnnotationsToUpdate, p.AnnotationsToRemove)
+}
+
+// ApplyToTags returns a copy of tags with the plan's tag changes applied.
+func (p SyncPlan) ApplyToTags(tags map[string]string) map[string]string {
+	return applyChanges(tags, p.TagsToAdd, p.TagsToUpdate, p.TagsToRemove)
+}
+
+func applyChanges(current, add, update map[string]string, remove []string) map[string]string {
+	result := make(map[string]string, len(current)+len(add))
+	for k, v := range current {
+		result[k] = v
+	}
+	for k, v := range add {
+		result[k] = v
+	}
+	for k, v := range update {
+		result[k] = v
+	}
+	for _, k := range remove {
+		delete(result, k)
+	}
+	return result
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func toSet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
+
+func sortedSet(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
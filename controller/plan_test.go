@@ -0,0 +1,420 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComputeSyncPlan(t *testing.T) {
+	options := func(direction SyncDirection, policy ConflictPolicy) ConfigOptions {
+		o := DefaultConfigOptions()
+		o.SyncDirection = direction
+		o.ConflictPolicy = policy
+		return o
+	}
+
+	tests := []struct {
+		name    string
+		state   SyncState
+		options ConfigOptions
+		want    SyncPlan
+	}{
+		{
+			name:    "arm-to-node adds missing labels",
+			state:   SyncState{Labels: map[string]string{"agentpool": "nodepool1"}, Tags: map[string]string{"env": "prod", "team": "infra"}},
+			options: options(ARMToNode, ARMPrecedence),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{"azure.tags/env": "prod", "azure.tags/team": "infra"},
+				LabelsToUpdate: map[string]string{},
+				TagsToAdd:      map[string]string{},
+				TagsToUpdate:   map[string]string{},
+				Managed:        ManagedKeys{Labels: []string{"azure.tags/env", "azure.tags/team"}},
+			},
+		},
+		{
+			name:    "arm-to-node with arm-precedence updates conflicting labels",
+			state:   SyncState{Labels: map[string]string{"azure.tags/env": "dev"}, Tags: map[string]string{"env": "prod"}},
+			options: options(ARMToNode, ARMPrecedence),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{},
+				LabelsToUpdate: map[string]string{"azure.tags/env": "prod"},
+				TagsToAdd:      map[string]string{},
+				TagsToUpdate:   map[string]string{},
+				Managed:        ManagedKeys{Labels: []string{"azure.tags/env"}},
+			},
+		},
+		{
+			name:    "arm-to-node with ignore reports conflicts",
+			state:   SyncState{Labels: map[string]string{"azure.tags/env": "dev"}, Tags: map[string]string{"env": "prod"}},
+			options: options(ARMToNode, Ignore),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{},
+				LabelsToUpdate: map[string]string{},
+				TagsToAdd:      map[string]string{},
+				TagsToUpdate:   map[string]string{},
+				Conflicts:      []Conflict{{Direction: ARMToNode, Target: LabelTarget, TagName: "env", TagVal: "prod", LabelName: "azure.tags/env", LabelVal: "dev"}},
+			},
+		},
+		{
+			name:    "node-to-arm adds labels as tags and skips system labels",
+			state:   SyncState{Labels: map[string]string{"agentpool": "nodepool1", "kubernetes.io/os": "linux"}, Tags: map[string]string{}},
+			options: options(NodeToARM, ARMPrecedence),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{},
+				LabelsToUpdate: map[string]string{},
+				TagsToAdd:      map[string]string{"node.labels.agentpool": "nodepool1"},
+				TagsToUpdate:   map[string]string{},
+				Filtered:       []FilteredKey{{Direction: NodeToARM, Key: "kubernetes.io/os", Rule: "kubernetes.io/*"}},
+				Managed:        ManagedKeys{Tags: []string{"node.labels.agentpool"}},
+			},
+		},
+		{
+			name:    "node-to-arm with node-precedence updates conflicting tags",
+			state:   SyncState{Labels: map[string]string{"azure.tags/env": "dev"}, Tags: map[string]string{"env": "prod"}},
+			options: options(NodeToARM, NodePrecedence),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{},
+				LabelsToUpdate: map[string]string{},
+				TagsToAdd:      map[string]string{},
+				TagsToUpdate:   map[string]string{"env": "dev"},
+				Managed:        ManagedKeys{Tags: []string{"env"}},
+			},
+		},
+		{
+			name:    "two-way does not echo tags copied to the node",
+			state:   SyncState{Labels: map[string]string{"agentpool": "nodepool1"}, Tags: map[string]string{"env": "prod"}},
+			options: options(TwoWay, ARMPrecedence),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{"azure.tags/env": "prod"},
+				LabelsToUpdate: map[string]string{},
+				TagsToAdd:      map[string]string{"node.labels.agentpool": "nodepool1"},
+				TagsToUpdate:   map[string]string{},
+				Managed:        ManagedKeys{Labels: []string{"azure.tags/env"}, Tags: []string{"node.labels.agentpool"}},
+			},
+		},
+		{
+			name:    "two-way with ignore reports each conflict once",
+			state:   SyncState{Labels: map[string]string{"azure.tags/env": "dev"}, Tags: map[string]string{"env": "prod"}},
+			options: options(TwoWay, Ignore),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{},
+				LabelsToUpdate: map[string]string{},
+				TagsToAdd:      map[string]string{},
+				TagsToUpdate:   map[string]string{},
+				Conflicts:      []Conflict{{Direction: ARMToNode, Target: LabelTarget, TagName: "env", TagVal: "prod", LabelName: "azure.tags/env", LabelVal: "dev"}},
+			},
+		},
+		{
+			name: "inherited tags are applied to the node but only overridden on the resource itself",
+			state: SyncState{
+				Labels:        map[string]string{"azure.tags/env": "dev", "rack": "3"},
+				Tags:          map[string]string{},
+				InheritedTags: map[string]string{"env": "prod"},
+			},
+			options: options(NodeToARM, NodePrecedence),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{},
+				LabelsToUpdate: map[string]string{},
+				TagsToAdd:      map[string]string{"env": "dev", "node.labels.rack": "3"},
+				TagsToUpdate:   map[string]string{},
+				Managed:        ManagedKeys{Tags: []string{"env", "node.labels.rack"}},
+			},
+		},
+		{
+			name: "own tags take precedence over inherited tags",
+			state: SyncState{
+				Labels:        map[string]string{},
+				Tags:          map[string]string{"env": "dev"},
+				InheritedTags: map[string]string{"env": "prod", "team": "infra"},
+			},
+			options: options(ARMToNode, ARMPrecedence),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{"azure.tags/env": "dev", "azure.tags/team": "infra"},
+				LabelsToUpdate: map[string]string{},
+				TagsToAdd:      map[string]string{},
+				TagsToUpdate:   map[string]string{},
+				Managed:        ManagedKeys{Labels: []string{"azure.tags/env", "azure.tags/team"}},
+			},
+		},
+		{
+			name: "labels copied from deleted tags are removed",
+			state: SyncState{
+				Labels:  map[string]string{"azure.tags/costcenter": "42", "azure.tags/manual": "x", "azure.tags/env": "prod"},
+				Tags:    map[string]string{"env": "prod"},
+				Managed: ManagedKeys{Labels: []string{"azure.tags/costcenter", "azure.tags/env"}},
+			},
+			options: options(ARMToNode, ARMPrecedence),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{},
+				LabelsToUpdate: map[string]string{},
+				LabelsToRemove: []string{"azure.tags/costcenter"},
+				TagsToAdd:      map[string]string{},
+				TagsToUpdate:   map[string]string{},
+				Managed:        ManagedKeys{Labels: []string{"azure.tags/env"}},
+			},
+		},
+		{
+			name: "managed labels follow tag changes regardless of conflict policy",
+			state: SyncState{
+				Labels:  map[string]string{"azure.tags/env": "dev"},
+				Tags:    map[string]string{"env": "prod"},
+				Managed: ManagedKeys{Labels: []string{"azure.tags/env"}},
+			},
+			options: options(ARMToNode, Ignore),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{},
+				LabelsToUpdate: map[string]string{"azure.tags/env": "prod"},
+				TagsToAdd:      map[string]string{},
+				TagsToUpdate:   map[string]string{},
+				Managed:        ManagedKeys{Labels: []string{"azure.tags/env"}},
+			},
+		},
+		{
+			name: "tags copied from deleted labels are removed and never copied back",
+			state: SyncState{
+				Labels:  map[string]string{"rack": "3"},
+				Tags:    map[string]string{"node.labels.rack": "3", "node.labels.zone": "1", "owner": "me"},
+				Managed: ManagedKeys{Tags: []string{"node.labels.rack", "node.labels.zone"}},
+			},
+			options: options(TwoWay, ARMPrecedence),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{"azure.tags/owner": "me"},
+				LabelsToUpdate: map[string]string{},
+				TagsToAdd:      map[string]string{},
+				TagsToUpdate:   map[string]string{},
+				TagsToRemove:   []string{"node.labels.zone"},
+				Managed:        ManagedKeys{Labels: []string{"azure.tags/owner"}, Tags: []string{"node.labels.rack"}},
+			},
+		},
+		{
+			name: "tags on shared resources are kept",
+			state: SyncState{
+				Labels:  map[string]string{},
+				Tags:    map[string]string{"node.labels.rack": "3"},
+				Managed: ManagedKeys{Tags: []string{"node.labels.rack"}},
+				Shared:  true,
+			},
+			options: options(NodeToARM, ARMPrecedence),
+			want: SyncPlan{
+				LabelsToAdd:    map[string]string{},
+				LabelsToUpdate: map[string]string{},
+				TagsToAdd:      map[string]string{},
+				TagsToUpdate:   map[string]string{},
+				Managed:        ManagedKeys{Tags: []string{"node.labels.rack"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ComputeSyncPlan(tt.state, tt.options)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ComputeSyncPlan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeSyncPlanTagLimit(t *testing.T) {
+	tags := map[string]string{}
+	for i := 0; i < maxNumTags-1; i++ {
+		tags[string(rune('a'+i%26))+string(rune('a'+i/26))] = "v"
+	}
+	options := DefaultConfigOptions()
+	options.SyncDirection = NodeToARM
+	state := SyncState{Labels: map[string]string{"x1": "v", "x2": "v"}, Tags: tags}
+
+	plan, err := ComputeSyncPlan(state, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.TagsToAdd) != 1 {
+		t.Errorf("expected 1 tag to be added before reaching the limit, got %d", len(plan.TagsToAdd))
+	}
+	if len(plan.Filtered) != 1 || plan.Filtered[0].Rule != tagLimitsRule {
+		t.Errorf("Filtered = %+v, want the label past the limit filtered by the tag limits", plan.Filtered)
+	}
+}
+
+func TestSyncPlanApply(t *testing.T) {
+	plan := SyncPlan{
+		LabelsToAdd:    map[string]string{"a": "1"},
+		LabelsToUpdate: map[string]string{"b": "2"},
+		LabelsToRemove: []string{"c"},
+	}
+	labels := map[string]string{"b": "1", "c": "1", "d": "1"}
+
+	got := plan.ApplyToLabels(labels)
+	want := map[string]string{"a": "1", "b": "2", "d": "1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ApplyToLabels() = %v, want %v", got, want)
+	}
+	if labels["b"] != "1" {
+		t.Errorf("ApplyToLabels() modified its input")
+	}
+	if !plan.LabelsChanged() || plan.TagsChanged() {
+		t.Errorf("unexpected LabelsChanged/TagsChanged result")
+	}
+}
+
+func TestComputeSyncPlanShortened(t *testing.T) {
+	longName := strings.Repeat("n", 100)
+	longVal := strings.Repeat("v", 100)
+	labelName, _ := ConvertTagNameToValidLabelName(longName, DefaultConfigOptions())
+	labelVal, _ := ConvertTagValToValidLabelVal(longVal, DefaultConfigOptions())
+	options := DefaultConfigOptions()
+	options.SyncDirection = TwoWay
+	options.ConflictPolicy = NodePrecedence
+
+	plan, err := ComputeSyncPlan(SyncState{Labels: map[string]string{}, Tags: map[string]string{longName: longVal}}, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(plan.LabelsToAdd, map[string]string{labelName: labelVal}) {
+		t.Errorf("LabelsToAdd = %v", plan.LabelsToAdd)
+	}
+	want := map[string]Original{labelName: {Tag: longName, Value: longVal}}
+	if !reflect.DeepEqual(plan.Originals, want) {
+		t.Errorf("Originals = %v, want %v", plan.Originals, want)
+	}
+	if plan.TagsChanged() {
+		t.Errorf("shortened label was copied back to ARM: %+v", plan)
+	}
+
+	// without the record of having created the label, the original tag and value are still restored
+	state := SyncState{Labels: map[string]string{labelName: labelVal}, Tags: map[string]string{longName: longVal + "x"}, Originals: plan.Originals}
+	plan, err = ComputeSyncPlan(state, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(plan.TagsToUpdate, map[string]string{longName: longVal}) || len(plan.TagsToAdd) != 0 {
+		t.Errorf("TagsToAdd = %v, TagsToUpdate = %v, want the original value restored", plan.TagsToAdd, plan.TagsToUpdate)
+	}
+}
+
+func TestComputeSyncPlanLongValidValue(t *testing.T) {
+	longVal := strings.Repeat("a_b", 30)
+	for _, policy := range []ValuePolicy{EscapeValue, SubstituteValue, SkipValue} {
+		options := DefaultConfigOptions()
+		options.ValuePolicy = policy
+
+		plan, err := ComputeSyncPlan(SyncState{Labels: map[string]string{}, Tags: map[string]string{"env": longVal}}, options)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := map[string]string{"azure.tags/env": shorten(longVal, maxLabelValLen)}
+		if !reflect.DeepEqual(plan.LabelsToAdd, want) {
+			t.Errorf("%s: LabelsToAdd = %v, want %v", policy, plan.LabelsToAdd, want)
+		}
+		if len(plan.Sanitized) != 0 {
+			t.Errorf("%s: Sanitized = %+v, want none for a value that was only shortened", policy, plan.Sanitized)
+		}
+	}
+}
+
+func TestComputeSyncPlanSanitized(t *testing.T) {
+	options := DefaultConfigOptions()
+	options.SyncDirection = TwoWay
+	options.ConflictPolicy = NodePrecedence
+	tags := map[string]string{"owner": "Jane Doe", "env": "prod"}
+
+	plan, err := ComputeSyncPlan(SyncState{Labels: map[string]string{}, Tags: tags}, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"azure.tags/owner": "Jane-Doe", "azure.tags/env": "prod"}
+	if !reflect.DeepEqual(plan.LabelsToAdd, want) {
+		t.Errorf("LabelsToAdd = %v, want %v", plan.LabelsToAdd, want)
+	}
+	wantSanitized := []SanitizedValue{{TagName: "owner", TagVal: "Jane Doe", LabelName: "azure.tags/owner", LabelVal: "Jane-Doe"}}
+	if !reflect.DeepEqual(plan.Sanitized, wantSanitized) {
+		t.Errorf("Sanitized = %+v, want %+v", plan.Sanitized, wantSanitized)
+	}
+	if !reflect.DeepEqual(plan.Originals, map[string]Original{"azure.tags/owner": {Value: "Jane Doe"}}) {
+		t.Errorf("Originals = %v", plan.Originals)
+	}
+
+	// the original value is restored when the label is copied back
+	state := SyncState{Labels: plan.ApplyToLabels(nil), Tags: map[string]string{"env": "prod"}, Originals: plan.Originals}
+	plan, err = ComputeSyncPlan(state, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(plan.TagsToAdd, map[string]string{"owner": "Jane Doe"}) {
+		t.Errorf("TagsToAdd = %v, want the original value", plan.TagsToAdd)
+	}
+
+	// skipping a value leaves the other tags alone
+	options.SyncDirection = ARMToNode
+	options.ValuePolicy = SkipValue
+	plan, err = ComputeSyncPlan(SyncState{Labels: map[string]string{}, Tags: tags}, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(plan.LabelsToAdd, map[string]string{"azure.tags/env": "prod"}) {
+		t.Errorf("LabelsToAdd = %v, want only the valid value", plan.LabelsToAdd)
+	}
+	if len(plan.Sanitized) != 1 || !plan.Sanitized[0].Skipped {
+		t.Errorf("Sanitized = %+v, want the skipped tag", plan.Sanitized)
+	}
+}
+
+func TestComputeSyncPlanAnnotations(t *testing.T) {
+	options := DefaultConfigOptions()
+	options.SyncDirection = TwoWay
+	options.ConflictPolicy = NodePrecedence
+	options.AnnotationTags = []string{"billing-*"}
+	tags := map[string]string{"billing-contact": "Jane Doe <jane@example.com>", "env": "prod"}
+
+	plan, err := ComputeSyncPlan(SyncState{Labels: map[string]string{}, Tags: tags}, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(plan.LabelsToAdd, map[string]string{"azure.tags/env": "prod"}) {
+		t.Errorf("LabelsToAdd = %v", plan.LabelsToAdd)
+	}
+	want := map[string]string{"azure.tags/billing-contact": "Jane Doe <jane@example.com>"}
+	if !reflect.DeepEqual(plan.AnnotationsToAdd, want) {
+		t.Errorf("AnnotationsToAdd = %v, want %v", plan.AnnotationsToAdd, want)
+	}
+	wantManaged := ManagedKeys{Labels: []string{"azure.tags/env"}, Annotations: []string{"azure.tags/billing-contact"}}
+	if !reflect.DeepEqual(plan.Managed, wantManaged) {
+		t.Errorf("Managed = %+v, want %+v", plan.Managed, wantManaged)
+	}
+	if plan.TagsChanged() || len(plan.Sanitized) != 0 {
+		t.Errorf("annotation was copied back to ARM or sanitized: %+v", plan)
+	}
+
+	// annotations the controller didn't create are copied to ARM, and its own are removed with their tag
+	state := SyncState{
+		Labels:      plan.ApplyToLabels(nil),
+		Annotations: map[string]string{"azure.tags/billing-contact": "Jane Doe <jane@example.com>", "azure.tags/Cost_20Center": "R&D / 42", "other/key": "x"},
+		Tags:        map[string]string{"env": "prod"},
+		Managed:     plan.Managed,
+	}
+	plan, err = ComputeSyncPlan(state, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(plan.AnnotationsToRemove, []string{"azure.tags/billing-contact"}) {
+		t.Errorf("AnnotationsToRemove = %v", plan.AnnotationsToRemove)
+	}
+	if !reflect.DeepEqual(plan.TagsToAdd, map[string]string{"Cost Center": "R&D / 42"}) {
+		t.Errorf("TagsToAdd = %v, want the unmanaged annotation", plan.TagsToAdd)
+	}
+
+	// with the target kind set, every tag goes to an annotation, so labels are no longer managed
+	options.TargetKind = AnnotationTarget
+	options.AnnotationTags = nil
+	plan, err = ComputeSyncPlan(SyncState{Labels: map[string]string{"azure.tags/env": "prod"}, Tags: tags, Managed: ManagedKeys{Labels: []string{"azure.tags/env"}}}, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(plan.LabelsToRemove, []string{"azure.tags/env"}) || len(plan.AnnotationsToAdd) != 2 {
+		t.Errorf("LabelsToRemove = %v, AnnotationsToAdd = %v", plan.LabelsToRemove, plan.AnnotationsToAdd)
+	}
+}
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	taglabelv1 "tag-label-sync.io/api/v1"
+)
+
+// matchingPolicies returns the TagLabelSyncConfigs that select the node, in order of precedence:
+// highest priority first, then by name. The first one is the policy that applies to the node.
+func matchingPolicies(node *corev1.Node, policies []taglabelv1.TagLabelSyncConfig) ([]taglabelv1.TagLabelSyncConfig, error) {
+	var matching []taglabelv1.TagLabelSyncConfig
+	for _, policy := range policies {
+		selected, err := selectsNode(policy, node)
+		if err != nil {
+			return nil, err
+		}
+		if selected {
+			matching = append(matching, policy)
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		if matching[i].Spec.Priority != matching[j].Spec.Priority {
+			return matching[i].Spec.Priority > matching[j].Spec.Priority
+		}
+		return matching[i].Name < matching[j].Name
+	})
+	return matching, nil
+}
+
+func selectsNode(policy taglabelv1.TagLabelSyncConfig, node *corev1.Node) (bool, error) {
+	if policy.Spec.NodeSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(policy.Spec.NodeSelector)
+	if err != nil {
+		return false, fmt.Errorf("invalid node selector in TagLabelSyncConfig %s: %v", policy.Name, err)
+	}
+	return selector.Matches(labels.Set(node.Labels)), nil
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	taglabelv1 "tag-label-sync.io/api/v1"
+)
+
+func TestMatchingPolicies(t *testing.T) {
+	policy := func(name string, priority int32, selector map[string]string) taglabelv1.TagLabelSyncConfig {
+		p := taglabelv1.TagLabelSyncConfig{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		p.Spec.Priority = priority
+		if selector != nil {
+			p.Spec.NodeSelector = &metav1.LabelSelector{MatchLabels: selector}
+		}
+		return p
+	}
+	policies := []taglabelv1.TagLabelSyncConfig{
+		policy("default", 0, nil),
+		policy("system", 10, map[string]string{"agentpool": "system"}),
+		policy("gpu", 10, map[string]string{"agentpool": "gpu"}),
+		policy("gpu-all", 10, map[string]string{"accelerator": "nvidia"}),
+	}
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []string
+	}{
+		{name: "policy without a selector applies to every node", labels: map[string]string{"agentpool": "user"}, want: []string{"default"}},
+		{name: "higher priority comes first", labels: map[string]string{"agentpool": "system"}, want: []string{"system", "default"}},
+		{name: "ties are ordered by name", labels: map[string]string{"agentpool": "gpu", "accelerator": "nvidia"}, want: []string{"gpu", "gpu-all", "default"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: tt.labels}}
+			got, err := matchingPolicies(node, policies)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var names []string
+			for _, p := range got {
+				names = append(names, p.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("matchingPolicies() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchingPoliciesInvalidSelector(t *testing.T) {
+	p := taglabelv1.TagLabelSyncConfig{ObjectMeta: metav1.ObjectMeta{Name: "bad"}}
+	p.Spec.NodeSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "a", Operator: "Bogus"}}}
+
+	if _, err := matchingPolicies(&corev1.Node{}, []taglabelv1.TagLabelSyncConfig{p}); err == nil {
+		t.Errorf("expected an error for an invalid selector")
+	}
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-03-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	"tag-label-sync.io/azure"
+	"tag-label-sync.io/azure/disks"
+	"tag-label-sync.io/azure/interfaces"
+)
+
+const (
+	diskResourceType      string = "Microsoft.Compute/disks"
+	interfaceResourceType string = "Microsoft.Network/networkInterfaces"
+)
+
+// attachment is a managed disk or network interface of a node's VM.
+type attachment struct {
+	kind     AttachedResource
+	resource *azure.ResourceID
+}
+
+// propagates is true if tags copied from node labels are written to any resources attached to the VM.
+func propagates(configOptions ConfigOptions) bool {
+	return len(configOptions.PropagateTo) > 0 &&
+		(configOptions.SyncDirection == TwoWay || configOptions.SyncDirection == NodeToARM)
+}
+
+// vmAttachments returns the configured kinds of resources attached to a VM, found through its storage and
+// network profiles, or nil if tags aren't synced to ARM. Network interfaces of scale set VMs belong to
+// the scale set and can't be tagged on their own, so they're left out, as are unmanaged disks.
+func vmAttachments(storage *compute.StorageProfile, network *compute.NetworkProfile, configOptions ConfigOptions) []attachment {
+	if !propagates(configOptions) {
+		return nil
+	}
+	var ids []string
+	if storage != nil && configOptions.Propagates(Disks) {
+		if storage.OsDisk != nil && storage.OsDisk.ManagedDisk != nil {
+			ids = append(ids, to.String(storage.OsDisk.ManagedDisk.ID))
+		}
+		if storage.DataDisks != nil {
+			for _, disk := range *storage.DataDisks {
+				if disk.ManagedDisk != nil {
+					ids = append(ids, to.String(disk.ManagedDisk.ID))
+				}
+			}
+		}
+	}
+	if network != nil && network.NetworkInterfaces != nil && configOptions.Propagates(NetworkInterfaces) {
+		for _, nic := range *network.NetworkInterfaces {
+			ids = append(ids, to.String(nic.ID))
+		}
+	}
+
+	var attachments []attachment
+	for _, id := range ids {
+		resource, err := azure.ParseResourceID(id)
+		if err != nil {
+			continue
+		}
+		switch {
+		case resource.IsType(diskResourceType):
+			attachments = append(attachments, attachment{kind: Disks, resource: resource})
+		case resource.IsType(interfaceResourceType):
+			attachments = append(attachments, attachment{kind: NetworkInterfaces, resource: resource})
+		}
+	}
+	return attachments
+}
+
+// syncedTags returns the tags the controller manages on the VM once the plan is applied to its tags.
+func syncedTags(plan SyncPlan, tags map[string]string) map[string]string {
+	applied := plan.ApplyToTags(tags)
+	synced := make(map[string]string, len(plan.Managed.Tags))
+	for _, tagName := range plan.Managed.Tags {
+		if tagVal, ok := applied[tagName]; ok {
+			synced[tagName] = tagVal
+		}
+	}
+	return synced
+}
+
+// propagatedTags returns an attached resource's tags with the synced tags set and the removed tags,
+// those propagated before that aren't synced anymore, removed. changed is false if the tags stay as
+// they are.
+func propagatedTags(current, synced map[string]string, removed []string) (tags map[string]string, changed bool) {
+	tags = make(map[string]string, len(current)+len(synced))
+	for k, v := range current {
+		tags[k] = v
+	}
+	for k, v := range synced {
+		if old, ok := tags[k]; !ok || old != v {
+			tags[k] = v
+			changed = true
+		}
+	}
+	for _, k := range removed {
+		if _, ok := tags[k]; ok {
+			delete(tags, k)
+			changed = true
+		}
+	}
+	return tags, changed
+}
+
+// pendingPropagation returns the record to keep while synced is being propagated, if synced has tags
+// that weren't propagated before. It has the tags of both, so tags that end up on some of the attached
+// resources are still removed later if the propagation fails, and no resources, so it's not in sync.
+func pendingPropagation(previous Propagated, synced map[string]string) (Propagated, bool) {
+	pending := Propagated{Tags: mergeTags(previous.Tags, synced)}
+	return pending, len(pending.Tags) > len(previous.Tags)
+}
+
+// propagateTags copies the tags synced to the node's resource to the resources attached to it, if the
+// provider supports it, and records what was copied on the node.
+func (r *ReconcileTagLabelSync) propagateTags(log logr.Logger, node *corev1.Node, provider TagProvider, tags ResourceTags, plan SyncPlan, configOptions ConfigOptions) error {
+	propagator, ok := provider.(TagPropagator)
+	if !ok || !propagates(configOptions) {
+		return nil
+	}
+	previous, err := propagated(node)
+	if err != nil {
+		// start over, the worst case is that tags no longer synced are left on the attached resources
+		log.Error(err, "invalid annotation, ignoring previously propagated tags", "annotation", PropagatedAnnotation)
+	}
+	synced := syncedTags(plan, tags.Tags)
+	if pending, ok := pendingPropagation(previous, synced); ok {
+		if err := r.patchPropagated(node, pending); err != nil {
+			return err
+		}
+	}
+	record, err := propagator.PropagateTags(r.ctx, tags, synced, previous)
+	if err != nil {
+		return err
+	}
+	return r.patchPropagated(node, record)
+}
+
+// PropagateTags writes the tags synced to the VM to the resources attached to it. Each resource is read
+// first and only written if its tags change, and none are read if the record shows they're in sync.
+func (p *azureTagProvider) PropagateTags(ctx context.Context, tags ResourceTags, synced map[string]string, previous Propagated) (Propagated, error) {
+	attached := tags.Object.(*azureObject).attached
+	record := Propagated{Tags: synced}
+	for _, a := range attached {
+		record.Resources = append(record.Resources, a.resource.String())
+	}
+	sort.Strings(record.Resources)
+	if record.inSync(previous) {
+		return record, nil
+	}
+
+	var removed []string
+	for k := range previous.Tags {
+		if _, ok := synced[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(removed)
+	for _, a := range attached {
+		var err error
+		switch a.kind {
+		case Disks:
+			err = p.propagateToDisk(ctx, a.resource, synced, removed)
+		case NetworkInterfaces:
+			err = p.propagateToInterface(ctx, a.resource, synced, removed)
+		}
+		if err != nil {
+			return Propagated{}, err
+		}
+	}
+	return record, nil
+}
+
+func (p *azureTagProvider) propagateToDisk(ctx context.Context, resource *azure.ResourceID, synced map[string]string, removed []string) error {
+	client, err := p.clients.disks(resource.SubscriptionID, resource.ResourceGroup)
+	if err != nil {
+		return err
+	}
+	disk, err := client.Get(ctx, resource.Name)
+	if err != nil {
+		return err
+	}
+	tags, changed := propagatedTags(to.StringMap(disk.Spec().Tags), synced, removed)
+	if !changed {
+		return nil
+	}
+	p.log.V(1).Info("applying labels to disk", "disk", resource.Name)
+	disk.Set(disks.Tags(*to.StringMapPtr(tags)))
+	return client.Update(ctx, resource.Name, disk)
+}
+
+func (p *azureTagProvider) propagateToInterface(ctx context.Context, resource *azure.ResourceID, synced map[string]string, removed []string) error {
+	client, err := p.clients.interfaces(resource.SubscriptionID, resource.ResourceGroup)
+	if err != nil {
+		return err
+	}
+	nic, err := client.Get(ctx, resource.Name)
+	if err != nil {
+		return err
+	}
+	tags, changed := propagatedTags(to.StringMap(nic.Spec().Tags), synced, removed)
+	if !changed {
+		return nil
+	}
+	p.log.V(1).Info("applying labels to network interface", "network interface", resource.Name)
+	nic.Set(interfaces.Tags(*to.StringMapPtr(tags)))
+	return client.Update(ctx, resource.Name, nic)
+}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-03-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"tag-label-sync.io/azure"
+	"tag-label-sync.io/azure/disks"
+)
+
+func TestVMAttachments(t *testing.T) {
+	const rg = "/subscriptions/sub/resourceGroups/rg/providers/"
+	storage := &compute.StorageProfile{
+		OsDisk: &compute.OSDisk{ManagedDisk: &compute.ManagedDiskParameters{ID: to.StringPtr(rg + "Microsoft.Compute/disks/os")}},
+		DataDisks: &[]compute.DataDisk{
+			{ManagedDisk: &compute.ManagedDiskParameters{ID: to.StringPtr(rg + "Microsoft.Compute/disks/data0")}},
+			{Vhd: &compute.VirtualHardDisk{URI: to.StringPtr("https://account.blob.core.windows.net/vhds/data1.vhd")}},
+		},
+	}
+	network := &compute.NetworkProfile{NetworkInterfaces: &[]compute.NetworkInterfaceReference{
+		{ID: to.StringPtr(rg + "Microsoft.Network/networkInterfaces/nic0")},
+		{ID: to.StringPtr(rg + "Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/0/networkInterfaces/nic1")},
+	}}
+
+	tests := []struct {
+		name    string
+		options ConfigOptions
+		want    []string
+	}{
+		{name: "disks and network interfaces", options: ConfigOptions{SyncDirection: TwoWay, PropagateTo: []AttachedResource{Disks, NetworkInterfaces}}, want: []string{"os", "data0", "nic0"}},
+		{name: "disks only", options: ConfigOptions{SyncDirection: NodeToARM, PropagateTo: []AttachedResource{Disks}}, want: []string{"os", "data0"}},
+		{name: "not syncing to ARM", options: ConfigOptions{SyncDirection: ARMToNode, PropagateTo: []AttachedResource{Disks}}, want: nil},
+		{name: "not configured", options: ConfigOptions{SyncDirection: TwoWay}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, a := range vmAttachments(storage, network, tt.options) {
+				if a.resource.ResourceGroup != "rg" {
+					t.Errorf("resource group = %s, want rg", a.resource.ResourceGroup)
+				}
+				got = append(got, a.resource.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("vmAttachments() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPropagatedTags(t *testing.T) {
+	options := DefaultConfigOptions()
+	options.SyncDirection = NodeToARM
+	state := SyncState{
+		Labels:  map[string]string{"rack": "r2"},
+		Tags:    map[string]string{"node.labels.rack": "r1", "node.labels.zone": "z1", "owner": "infra"},
+		Managed: ManagedKeys{Labels: []string{}, Tags: []string{"node.labels.rack", "node.labels.zone"}},
+	}
+	plan, err := ComputeSyncPlan(state, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	synced := syncedTags(plan, state.Tags)
+	if want := map[string]string{"node.labels.rack": "r2"}; !reflect.DeepEqual(synced, want) {
+		t.Fatalf("syncedTags() = %v, want %v", synced, want)
+	}
+
+	// zone was propagated before and isn't synced anymore
+	removed := []string{"node.labels.zone"}
+	disk := map[string]string{"node.labels.zone": "z1", "owner": "storage"}
+	got, changed := propagatedTags(disk, synced, removed)
+	// the VM's own tags aren't copied, only those synced from labels
+	if want := map[string]string{"node.labels.rack": "r2", "owner": "storage"}; !changed || !reflect.DeepEqual(got, want) {
+		t.Errorf("propagatedTags() = %v, %v, want %v, true", got, changed, want)
+	}
+	if _, changed := propagatedTags(got, synced, removed); changed {
+		t.Errorf("propagatedTags() changed tags that were already propagated")
+	}
+}
+
+// fakeDisks keeps the tags of each disk in memory, keyed by name.
+type fakeDisks struct {
+	tags   map[string]map[string]string
+	gets   int
+	writes int
+}
+
+func (f *fakeDisks) Get(ctx context.Context, group, name string) (compute.Disk, error) {
+	f.gets++
+	return compute.Disk{Name: to.StringPtr(name), Tags: *to.StringMapPtr(f.tags[name])}, nil
+}
+
+func (f *fakeDisks) Update(ctx context.Context, group, name string, update compute.DiskUpdate) (compute.Disk, error) {
+	f.writes++
+	f.tags[name] = to.StringMap(update.Tags)
+	return compute.Disk{Name: to.StringPtr(name), Tags: update.Tags}, nil
+}
+
+func TestAzurePropagateTags(t *testing.T) {
+	service := &fakeDisks{tags: map[string]map[string]string{
+		"os": {"node.labels.zone": "z1", "owner": "storage"},
+	}}
+	p := &azureTagProvider{log: ctrl.Log.WithName("test"), clients: AzureClients{
+		Disks: func(subID, group string) (*disks.Client, error) { return disks.NewClientService(group, service), nil },
+	}}
+	id, err := azure.ParseResourceID("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/os")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := ResourceTags{Object: &azureObject{attached: []attachment{{kind: Disks, resource: id}}}}
+	ctx := context.Background()
+
+	// zone was propagated by an earlier sync, even though the VM's plan doesn't remove it anymore
+	previous := Propagated{Tags: map[string]string{"node.labels.zone": "z1"}, Resources: []string{id.String()}}
+	synced := map[string]string{"node.labels.rack": "r2"}
+	record, err := p.PropagateTags(ctx, tags, synced, previous)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[string]string{"node.labels.rack": "r2", "owner": "storage"}; !reflect.DeepEqual(service.tags["os"], want) {
+		t.Errorf("disk tags = %v, want %v", service.tags["os"], want)
+	}
+	if want := (Propagated{Tags: synced, Resources: []string{id.String()}}); !reflect.DeepEqual(record, want) {
+		t.Errorf("PropagateTags() = %v, want %v", record, want)
+	}
+
+	gets := service.gets
+	if _, err := p.PropagateTags(ctx, tags, synced, record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if service.gets != gets || service.writes != 1 {
+		t.Errorf("attached resources were read or written although they're in sync")
+	}
+}
+
+// propagatingTagProvider records the previous propagation it's given, and fails while err is set.
+type propagatingTagProvider struct {
+	fakeTagProvider
+	resources []string
+	previous  Propagated
+	err       error
+}
+
+func (p *propagatingTagProvider) PropagateTags(ctx context.Context, tags ResourceTags, synced map[string]string, previous Propagated) (Propagated, error) {
+	p.previous = previous
+	if p.err != nil {
+		return Propagated{}, p.err
+	}
+	return Propagated{Tags: synced, Resources: p.resources}, nil
+}
+
+func TestPropagateTagsRecord(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-0"}}
+	r := newTestReconciler(node)
+	r.ctx = context.Background()
+	options := DefaultConfigOptions()
+	options.SyncDirection = NodeToARM
+	options.PropagateTo = []AttachedResource{Disks}
+	plan := SyncPlan{Managed: ManagedKeys{Tags: []string{"node.labels.rack"}}}
+	tags := ResourceTags{Tags: map[string]string{"node.labels.rack": "r1"}}
+	provider := &propagatingTagProvider{resources: []string{"os"}, err: errors.New("throttled")}
+
+	recorded := func() Propagated {
+		var got corev1.Node
+		if err := r.Get(r.ctx, types.NamespacedName{Name: "node-0"}, &got); err != nil {
+			t.Fatal(err)
+		}
+		record, err := propagated(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	if err := r.propagateTags(r.Log, node, provider, tags, plan, options); err == nil {
+		t.Fatalf("expected the propagation error")
+	}
+	// the new tag may be on some of the attached resources, so it's recorded, but not as in sync
+	pending := Propagated{Tags: map[string]string{"node.labels.rack": "r1"}}
+	if got := recorded(); !reflect.DeepEqual(got, pending) {
+		t.Errorf("record after a failed propagation = %v, want %v", got, pending)
+	}
+
+	provider.err = nil
+	if err := r.propagateTags(r.Log, node, provider, tags, plan, options); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(provider.previous, pending) {
+		t.Errorf("previous = %v, want the pending record %v", provider.previous, pending)
+	}
+	want := Propagated{Tags: map[string]string{"node.labels.rack": "r1"}, Resources: []string{"os"}}
+	if got := recorded(); !reflect.DeepEqual(got, want) {
+		t.Errorf("record = %v, want %v", got, want)
+	}
+}
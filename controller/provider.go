@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"tag-label-sync.io/aws/autoscalinggroups"
+	awsinstances "tag-label-sync.io/aws/instances"
+	gceinstances "tag-label-sync.io/gce/instances"
+)
+
+// TagProvider syncs nodes with the tags of the cloud resources behind them. The controller picks a
+// provider by the scheme of the node's provider ID, e.g. "azure" for "azure:///subscriptions/...".
+type TagProvider interface {
+	// Resolve parses a node's provider ID into the resource the node is synced with. selected is false
+	// if the options leave the resource out of syncing.
+	Resolve(providerID string, configOptions ConfigOptions) (resource NodeResource, selected bool, err error)
+	// ReadTags reads the resource's tags, and any tags it inherits.
+	ReadTags(ctx context.Context, resource NodeResource, configOptions ConfigOptions) (ResourceTags, error)
+	// WriteTags applies the plan's tag changes to the resource the tags were read from.
+	WriteTags(ctx context.Context, tags ResourceTags, plan SyncPlan, configOptions ConfigOptions) error
+}
+
+// TagPropagator is implemented by providers that also copy the tags synced from node labels to the
+// resources attached to a node's resource.
+type TagPropagator interface {
+	// PropagateTags writes synced to the attached resources, and removes the tags recorded in previous
+	// that aren't in synced from them. It returns the new record, and writes nothing if previous shows
+	// the attached resources are already in sync.
+	PropagateTags(ctx context.Context, tags ResourceTags, synced map[string]string, previous Propagated) (Propagated, error)
+}
+
+// NodeResource is the cloud resource a node's provider ID resolves to.
+type NodeResource struct {
+	ProviderID string
+	// Type and Name describe the resource in logs.
+	Type string
+	Name string
+	// ID is the provider's own parsed form of the provider ID.
+	ID interface{}
+}
+
+// ResourceTags are the tags read from a node's resource.
+type ResourceTags struct {
+	Resource NodeResource
+	// Tags are the resource's own tags, the only ones that are written back.
+	Tags map[string]string
+	// InheritedTags are applied to the node underneath Tags but never written.
+	InheritedTags map[string]string
+	// Shared is true if other nodes are synced with the same resource.
+	Shared bool
+	// Limits are the limits on the resource's tags.
+	Limits TagLimits
+	// Object is what the provider read the tags from, for WriteTags to write them back to.
+	Object interface{}
+}
+
+// state returns the sync state of the tags, to be completed with the node's.
+func (t ResourceTags) state() SyncState {
+	return SyncState{Tags: t.Tags, InheritedTags: t.InheritedTags, Shared: t.Shared, Limits: t.Limits}
+}
+
+// Provider ID schemes.
+const (
+	AzureScheme string = "azure"
+	AWSScheme   string = "aws"
+	GCEScheme   string = "gce"
+)
+
+// DefaultTagProviders returns the providers the controller supports, keyed by provider ID scheme. The
+// Azure provider creates its clients with azureClients, the AWS provider shares one client per region,
+// and the GCE provider one per project and zone. They're meant to be created once and used for every node.
+func DefaultTagProviders(log logr.Logger, azureClients AzureClients) map[string]TagProvider {
+	return map[string]TagProvider{
+		AzureScheme: &azureTagProvider{log: log.WithName(AzureScheme), clients: azureClients},
+		AWSScheme: &awsTagProvider{
+			log:             log.WithName(AWSScheme),
+			instanceClients: awsinstances.NewCachedClientFactory(),
+			groupClients:    autoscalinggroups.NewCachedClientFactory(),
+		},
+		GCEScheme: &gceTagProvider{log: log.WithName(GCEScheme), clients: gceinstances.NewCachedClientFactory()},
+	}
+}
+
+// providerScheme returns the scheme of a provider ID, or "" if it has none.
+func providerScheme(providerID string) string {
+	i := strings.Index(providerID, "://")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(providerID[:i])
+}
+
+// tagProvider returns the provider for a node's provider ID.
+func (r *ReconcileTagLabelSync) tagProvider(providerID string) (TagProvider, error) {
+	scheme := providerScheme(providerID)
+	if provider, ok := r.Providers[scheme]; ok {
+		return provider, nil
+	}
+	return nil, fmt.Errorf("no tag provider for provider ID %q", providerID)
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+
+	"tag-label-sync.io/aws"
+	"tag-label-sync.io/aws/autoscalinggroups"
+	"tag-label-sync.io/aws/instances"
+)
+
+// EC2Instance is the resource type of nodes on EC2.
+const EC2Instance string = "instance"
+
+// AWSTagLimits are the limits on the tags of EC2 resources. Tags starting with "aws:" belong to AWS.
+var AWSTagLimits = TagLimits{MaxTags: 50, MaxNameLen: 128, MaxValueLen: 256, ReservedPrefixes: []string{"aws:"}}
+
+// awsTagProvider syncs nodes with the tags of EC2 instances.
+type awsTagProvider struct {
+	log logr.Logger
+	// instanceClients and groupClients create the clients, or the packages' NewClient does if nil.
+	instanceClients instances.ClientFactory
+	groupClients    autoscalinggroups.ClientFactory
+}
+
+func (p *awsTagProvider) Resolve(providerID string, configOptions ConfigOptions) (NodeResource, bool, error) {
+	instance, err := aws.ParseProviderID(providerID)
+	if err != nil {
+		return NodeResource{}, false, err
+	}
+	// the resource group and subscription filters only apply on Azure
+	return NodeResource{ProviderID: providerID, Type: EC2Instance, Name: instance.InstanceID, ID: instance}, true, nil
+}
+
+func (p *awsTagProvider) ReadTags(ctx context.Context, resource NodeResource, configOptions ConfigOptions) (ResourceTags, error) {
+	instance := resource.ID.(aws.Instance)
+	newClient := p.instanceClients
+	if newClient == nil {
+		newClient = instances.NewClient
+	}
+	client, err := newClient(instance.Region)
+	if err != nil {
+		return ResourceTags{}, fmt.Errorf("failed to create EC2 client: %v", err)
+	}
+	tags, err := client.Tags(ctx, instance.InstanceID)
+	if err != nil {
+		return ResourceTags{}, fmt.Errorf("failed to get instance tags: %v", err)
+	}
+
+	var inherited map[string]string
+	if group := tags[instances.AutoScalingGroupTag]; group != "" && configOptions.Inherits(AutoScalingGroupTags) {
+		newGroupClient := p.groupClients
+		if newGroupClient == nil {
+			newGroupClient = autoscalinggroups.NewClient
+		}
+		groupClient, err := newGroupClient(instance.Region)
+		if err != nil {
+			return ResourceTags{}, fmt.Errorf("failed to create Auto Scaling client: %v", err)
+		}
+		// instances get these tags at launch, but not changes made to the group afterwards
+		inherited, err = groupClient.PropagatedTags(ctx, group)
+		if err != nil {
+			return ResourceTags{}, fmt.Errorf("failed to get Auto Scaling group tags: %v", err)
+		}
+	}
+
+	return ResourceTags{
+		Resource:      resource,
+		Tags:          tags,
+		InheritedTags: mergeTags(inherited),
+		Limits:        AWSTagLimits,
+		Object:        client,
+	}, nil
+}
+
+func (p *awsTagProvider) WriteTags(ctx context.Context, tags ResourceTags, plan SyncPlan, configOptions ConfigOptions) error {
+	if !plan.TagsChanged() {
+		return nil
+	}
+	instance := tags.Resource.ID.(aws.Instance)
+	client := tags.Object.(*instances.Client)
+	p.log.V(1).Info("applying labels to EC2 instance", "instance", instance.InstanceID,
+		"add", plan.TagsToAdd, "update", plan.TagsToUpdate, "remove", plan.TagsToRemove)
+
+	set := mergeTags(plan.TagsToAdd, plan.TagsToUpdate)
+	if err := client.UpdateTags(ctx, instance.InstanceID, set, plan.TagsToRemove); err != nil {
+		return fmt.Errorf("failed to update instance tags: %v", err)
+	}
+	return nil
+}
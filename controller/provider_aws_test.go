@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"tag-label-sync.io/aws/awstest"
+	"tag-label-sync.io/aws/instances"
+)
+
+func TestReconcileEC2Instance(t *testing.T) {
+	server := awstest.NewServer()
+	defer server.Close()
+	server.Instances["i-0abc"] = map[string]string{"env": "prod", instances.AutoScalingGroupTag: "workers"}
+	server.Groups["workers"] = map[string]awstest.GroupTag{
+		"team":     {Value: "infra", PropagateAtLaunch: true},
+		"internal": {Value: "yes"},
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-0", Labels: map[string]string{
+			"rack":               "r1",
+			"ec2.tags/aws_3Afoo": "bar", // would be the reserved tag "aws:foo"
+		}},
+		Spec: corev1.NodeSpec{ProviderID: "aws:///us-west-2a/i-0abc"},
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: ConfigMapNamespace},
+		Data: map[string]string{
+			"syncDirection": "two-way",
+			"labelPrefix":   "ec2.tags",
+			"inheritFrom":   "auto-scaling-group",
+			"labelExclude":  "",
+		},
+	}
+	r := newTestReconciler(node, configMap)
+	r.Providers = DefaultTagProviders(r.Log, r.AzureClients)
+	r.Providers[AWSScheme] = &awsTagProvider{log: r.Log, instanceClients: server.InstanceClients(), groupClients: server.AutoScalingGroupClients()}
+
+	if _, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "node-0"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got corev1.Node
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "node-0"}, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for label, want := range map[string]string{"ec2.tags/env": "prod", "ec2.tags/team": "infra", "ec2.tags/internal": ""} {
+		if got.Labels[label] != want {
+			t.Errorf("label %s = %q, want %q", label, got.Labels[label], want)
+		}
+	}
+	wantTags := map[string]string{"env": "prod", instances.AutoScalingGroupTag: "workers", "node.labels.rack": "r1"}
+	if tags := server.InstanceTags("i-0abc"); !reflect.DeepEqual(tags, wantTags) {
+		t.Errorf("instance tags = %v, want %v", tags, wantTags)
+	}
+}
+
+func TestComputeSyncPlanAWSTagLimits(t *testing.T) {
+	options := DefaultConfigOptions()
+	options.SyncDirection = NodeToARM
+	options.LabelFilter = KeyFilter{}
+	// a valid label, but a tag name over EC2's 128 characters
+	segment := strings.Repeat("a", 60)
+	state := SyncState{
+		Labels: map[string]string{
+			segment + "." + segment + ".example.com/zone": "z1",
+			"rack": "r1",
+		},
+		Tags:   map[string]string{},
+		Limits: AWSTagLimits,
+	}
+
+	plan, err := ComputeSyncPlan(state, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[string]string{"node.labels.rack": "r1"}; !reflect.DeepEqual(plan.TagsToAdd, want) {
+		t.Errorf("TagsToAdd = %v, want %v", plan.TagsToAdd, want)
+	}
+	if len(plan.Filtered) != 1 || plan.Filtered[0].Rule != tagLimitsRule {
+		t.Errorf("Filtered = %+v, want the long label filtered by the tag limits", plan.Filtered)
+	}
+}
@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/go-logr/logr"
+
+	"tag-label-sync.io/azure"
+	"tag-label-sync.io/azure/disks"
+	"tag-label-sync.io/azure/groups"
+	"tag-label-sync.io/azure/interfaces"
+	"tag-label-sync.io/azure/scalesets"
+	"tag-label-sync.io/azure/scalesetvms"
+	"tag-label-sync.io/azure/subscriptions"
+	"tag-label-sync.io/azure/vms"
+)
+
+const (
+	VM   string = "virtualMachines"
+	VMSS string = "virtualMachineScaleSets"
+)
+
+// The full types of the resources a node's provider ID can name.
+const (
+	vmType     string = "Microsoft.Compute/" + VM
+	vmssVMType string = "Microsoft.Compute/" + VMSS + "/" + VM
+)
+
+// AzureClients create the clients the Azure tag provider reads and writes VMs and scale sets, the
+// resources attached to them and those they inherit tags from with, so that tests and other backends
+// can plug in their own. A nil factory creates a new client, with its own auth, every time.
+type AzureClients struct {
+	ScaleSets     scalesets.ClientFactory
+	ScaleSetVMs   scalesetvms.ClientFactory
+	VMs           vms.ClientFactory
+	Disks         disks.ClientFactory
+	Interfaces    interfaces.ClientFactory
+	Groups        groups.ClientFactory
+	Subscriptions subscriptions.ClientFactory
+}
+
+// CachedAzureClients returns factories that create one client per subscription and reuse it.
+func CachedAzureClients() AzureClients {
+	return AzureClients{
+		ScaleSets:     scalesets.NewCachedClientFactory(),
+		ScaleSetVMs:   scalesetvms.NewCachedClientFactory(),
+		VMs:           vms.NewCachedClientFactory(),
+		Disks:         disks.NewCachedClientFactory(),
+		Interfaces:    interfaces.NewCachedClientFactory(),
+		Groups:        groups.NewCachedClientFactory(),
+		Subscriptions: subscriptions.NewCachedClientFactory(),
+	}
+}
+
+func (c AzureClients) scaleSets(subID, group string) (*scalesets.Client, error) {
+	if c.ScaleSets == nil {
+		return scalesets.NewClient(subID, group)
+	}
+	return c.ScaleSets(subID, group)
+}
+
+func (c AzureClients) scaleSetVMs(subID, group string) (*scalesetvms.Client, error) {
+	if c.ScaleSetVMs == nil {
+		return scalesetvms.NewClient(subID, group)
+	}
+	return c.ScaleSetVMs(subID, group)
+}
+
+func (c AzureClients) vms(subID, group string) (*vms.Client, error) {
+	if c.VMs == nil {
+		return vms.NewClient(subID, group)
+	}
+	return c.VMs(subID, group)
+}
+
+func (c AzureClients) disks(subID, group string) (*disks.Client, error) {
+	if c.Disks == nil {
+		return disks.NewClient(subID, group)
+	}
+	return c.Disks(subID, group)
+}
+
+func (c AzureClients) interfaces(subID, group string) (*interfaces.Client, error) {
+	if c.Interfaces == nil {
+		return interfaces.NewClient(subID, group)
+	}
+	return c.Interfaces(subID, group)
+}
+
+func (c AzureClients) groups(subID string) (*groups.Client, error) {
+	if c.Groups == nil {
+		return groups.NewClient(subID)
+	}
+	return c.Groups(subID)
+}
+
+func (c AzureClients) subscriptions(subID string) (*subscriptions.Client, error) {
+	if c.Subscriptions == nil {
+		return subscriptions.NewClient(subID)
+	}
+	return c.Subscriptions(subID)
+}
+
+// azureTagProvider syncs nodes with the tags of Azure VMs and scale sets.
+type azureTagProvider struct {
+	log     logr.Logger
+	clients AzureClients
+}
+
+// azureObject is what the tags were read from: a scale set, one of its VMs, or a VM.
+type azureObject struct {
+	vmss         *scalesets.Spec
+	vmssClient   *scalesets.Client
+	vmssVM       *scalesetvms.Spec
+	vmssVMClient *scalesetvms.Client
+	vm           *vms.Spec
+	vmClient     *vms.Client
+	attached     []attachment
+}
+
+func (p *azureTagProvider) Resolve(providerID string, configOptions ConfigOptions) (NodeResource, bool, error) {
+	resource, err := azure.ParseProviderID(providerID)
+	if err != nil {
+		return NodeResource{}, false, err
+	}
+	// the types are case-insensitive, so use the usual case from here on
+	switch {
+	case resource.ID.IsType(vmssVMType):
+		resource.ResourceType = VMSS
+	case resource.ID.IsType(vmType):
+		resource.ResourceType = VM
+	default:
+		return NodeResource{}, false, fmt.Errorf("unrecognized resource type %s", resource.ID.FullType())
+	}
+	nodeResource := NodeResource{ProviderID: providerID, Type: resource.ResourceType, Name: resource.ResourceName, ID: resource}
+	return nodeResource, configOptions.Selects(resource), nil
+}
+
+func (p *azureTagProvider) ReadTags(ctx context.Context, nodeResource NodeResource, configOptions ConfigOptions) (ResourceTags, error) {
+	resource := nodeResource.ID.(azure.Resource)
+	inherited, err := inheritedTags(ctx, p.clients, resource, configOptions)
+	if err != nil {
+		return ResourceTags{}, fmt.Errorf("failed to get inherited tags: %v", err)
+	}
+
+	tags := ResourceTags{Resource: nodeResource, InheritedTags: inherited, Limits: AzureTagLimits}
+	object := &azureObject{}
+	tags.Object = object
+	switch resource.ResourceType {
+	case VMSS:
+		object.vmssClient, err = p.clients.scaleSets(resource.SubscriptionID, resource.ResourceGroup)
+		if err != nil {
+			return ResourceTags{}, fmt.Errorf("failed to create VMSS client: %v", err)
+		}
+		object.vmss, err = object.vmssClient.Get(ctx, resource.ResourceName)
+		if err != nil {
+			return ResourceTags{}, fmt.Errorf("failed to get VMSS: %v", err)
+		}
+
+		// the scale set's tags are synced unless the instance is the target, but tags are always
+		// propagated to the instance's own disks
+		if configOptions.VMSSTarget == Instance || propagates(configOptions) {
+			object.vmssVMClient, err = p.clients.scaleSetVMs(resource.SubscriptionID, resource.ResourceGroup)
+			if err != nil {
+				return ResourceTags{}, fmt.Errorf("failed to create VMSS VM client: %v", err)
+			}
+			object.vmssVM, err = object.vmssVMClient.Get(ctx, resource.ResourceName, resource.InstanceID)
+			if err != nil {
+				return ResourceTags{}, fmt.Errorf("failed to get VMSS VM: %v", err)
+			}
+			object.attached = vmAttachments(object.vmssVM.Spec().StorageProfile, object.vmssVM.Spec().NetworkProfile, configOptions)
+		}
+
+		if configOptions.VMSSTarget == Instance {
+			// sync with a single VM of a VMSS, so labels on one node don't spread to the whole pool. The
+			// VMSS's own tags are still applied to the node but are never written.
+			tags.Tags = to.StringMap(object.vmssVM.Spec().Tags)
+			tags.InheritedTags = mergeTags(inherited, to.StringMap(object.vmss.Spec().Tags))
+			break
+		}
+		tags.Tags = to.StringMap(object.vmss.Spec().Tags)
+		tags.Shared = true
+		object.vmssVM = nil
+	case VM:
+		object.vmClient, err = p.clients.vms(resource.SubscriptionID, resource.ResourceGroup)
+		if err != nil {
+			return ResourceTags{}, fmt.Errorf("failed to create VM client: %v", err)
+		}
+		object.vm, err = object.vmClient.Get(ctx, resource.ResourceName)
+		if err != nil {
+			return ResourceTags{}, fmt.Errorf("failed to get VM: %v", err)
+		}
+		tags.Tags = to.StringMap(object.vm.Spec().Tags)
+		object.attached = vmAttachments(object.vm.Spec().StorageProfile, object.vm.Spec().NetworkProfile, configOptions)
+	}
+	return tags, nil
+}
+
+func (p *azureTagProvider) WriteTags(ctx context.Context, tags ResourceTags, plan SyncPlan, configOptions ConfigOptions) error {
+	object := tags.Object.(*azureObject)
+	log := p.log.WithValues("resource", tags.Resource.Name)
+
+	if plan.TagsChanged() {
+		newTags := *to.StringMapPtr(plan.ApplyToTags(tags.Tags))
+		switch {
+		case object.vmssVM != nil:
+			log.V(1).Info("applying labels to VMSS VM", "add", plan.TagsToAdd, "update", plan.TagsToUpdate, "remove", plan.TagsToRemove)
+			object.vmssVM.Spec().Tags = newTags
+			if err := object.vmssVMClient.Update(ctx, *object.vmss.Spec().Name, *object.vmssVM.Spec().InstanceID, object.vmssVM); err != nil {
+				return fmt.Errorf("failed to update VMSS VM: %v", err)
+			}
+		case object.vmss != nil:
+			log.V(1).Info("applying labels to VMSS", "add", plan.TagsToAdd, "update", plan.TagsToUpdate, "remove", plan.TagsToRemove)
+			object.vmss.Spec().Tags = newTags
+			if err := object.vmssClient.Update(ctx, *object.vmss.Spec().Name, object.vmss); err != nil {
+				return fmt.Errorf("failed to update VMSS: %v", err)
+			}
+		case object.vm != nil:
+			log.V(1).Info("applying labels to VM", "add", plan.TagsToAdd, "update", plan.TagsToUpdate, "remove", plan.TagsToRemove)
+			object.vm.Set(vms.Tags(newTags))
+			if err := object.vmClient.Update(ctx, *object.vm.Spec().Name, object.vm); err != nil {
+				return fmt.Errorf("failed to update VM: %v", err)
+			}
+		}
+	}
+	return nil
+}
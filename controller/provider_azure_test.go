@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"tag-label-sync.io/azure/azuretest"
+	"tag-label-sync.io/azure/scalesets"
+)
+
+const testResourceGroup = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/"
+
+// serverClients are AzureClients of SDK clients that call server.
+func serverClients(server *azuretest.Server) AzureClients {
+	return AzureClients{
+		ScaleSets:   server.ScaleSetClients(),
+		ScaleSetVMs: server.ScaleSetVMClients(),
+		VMs:         server.VMClients(),
+	}
+}
+
+func TestReconcileAzureResources(t *testing.T) {
+	tests := []struct {
+		name       string
+		providerID string
+		vmssTarget string
+		written    string
+		requests   map[string]int
+	}{
+		{
+			name:       "VM",
+			providerID: "azure://" + testResourceGroup + "virtualMachines/node-0",
+			written:    testResourceGroup + "virtualMachines/node-0",
+			requests:   map[string]int{"GET virtualMachines": 2, "PATCH virtualMachines": 1, "GET operations": 2},
+		},
+		{
+			name:       "scale set",
+			providerID: "azure://" + testResourceGroup + "virtualMachineScaleSets/vmss/virtualMachines/3",
+			written:    testResourceGroup + "virtualMachineScaleSets/vmss",
+			requests:   map[string]int{"GET virtualMachineScaleSets": 2, "PUT virtualMachineScaleSets": 1, "GET operations": 2},
+		},
+		{
+			name:       "scale set VM",
+			providerID: "azure://" + testResourceGroup + "virtualMachineScaleSets/vmss/virtualMachines/3",
+			vmssTarget: "instance",
+			written:    testResourceGroup + "virtualMachineScaleSets/vmss/virtualMachines/3",
+			requests: map[string]int{"GET virtualMachineScaleSets": 1, "GET virtualMachineScaleSets/virtualMachines": 2,
+				"PUT virtualMachineScaleSets/virtualMachines": 1, "GET operations": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := azuretest.NewServer()
+			defer server.Close()
+
+			server.Put(testResourceGroup+"virtualMachines/node-0", map[string]string{"env": "prod"})
+			server.Put(testResourceGroup+"virtualMachineScaleSets/vmss", map[string]string{"env": "prod"})
+			server.Put(testResourceGroup+"virtualMachineScaleSets/vmss/virtualMachines/3", map[string]string{"env": "prod"})
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node-0", Labels: map[string]string{"rack": "r1"}},
+				Spec:       corev1.NodeSpec{ProviderID: tt.providerID},
+			}
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: ConfigMapNamespace},
+				Data:       map[string]string{"syncDirection": "two-way", "vmssTarget": tt.vmssTarget, "labelExclude": ""},
+			}
+			r := newTestReconciler(node, configMap)
+			r.Providers = DefaultTagProviders(r.Log, serverClients(server))
+
+			if _, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "node-0"}}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got corev1.Node
+			if err := r.Get(context.Background(), types.NamespacedName{Name: "node-0"}, &got); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Labels["azure.tags/env"] != "prod" {
+				t.Errorf("labels = %v, want azure.tags/env=prod", got.Labels)
+			}
+			want := map[string]string{"env": "prod", "node.labels.rack": "r1"}
+			if tags := server.Tags(tt.written); !reflect.DeepEqual(tags, want) {
+				t.Errorf("tags of %s = %v, want %v", tt.written, tags, want)
+			}
+			if !reflect.DeepEqual(server.Requests, tt.requests) {
+				t.Errorf("requests = %v, want %v", server.Requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestReconcileWithAzureClients(t *testing.T) {
+	c := azuretest.NewCompute()
+	c.Put(testResourceGroup+"virtualMachineScaleSets/vmss", map[string]string{"env": "prod"})
+	c.Put(testResourceGroup+"virtualMachineScaleSets/vmss/virtualMachines/3", nil)
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-0", Labels: map[string]string{"rack": "r1"}},
+		Spec:       corev1.NodeSpec{ProviderID: "azure://" + testResourceGroup + "virtualMachineScaleSets/vmss/virtualMachines/3"},
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: ConfigMapNamespace},
+		Data:       map[string]string{"syncDirection": "two-way", "labelExclude": ""},
+	}
+	r := newTestReconciler(node, configMap)
+	var created []string
+	scaleSets := c.ScaleSetClients()
+	r.AzureClients = AzureClients{
+		ScaleSets: func(subID, group string) (*scalesets.Client, error) {
+			created = append(created, subID+"/"+group)
+			return scaleSets(subID, group)
+		},
+		ScaleSetVMs: c.ScaleSetVMClients(),
+		VMs:         c.VMClients(),
+	}
+	r.Providers = DefaultTagProviders(r.Log, r.AzureClients)
+
+	if _, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "node-0"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{"env": "prod", "node.labels.rack": "r1"}
+	if tags := c.Tags(testResourceGroup + "virtualMachineScaleSets/vmss"); !reflect.DeepEqual(tags, want) {
+		t.Errorf("scale set tags = %v, want %v", tags, want)
+	}
+	if !reflect.DeepEqual(created, []string{"sub/rg"}) {
+		t.Errorf("scale set clients created for %v, want one for sub/rg", created)
+	}
+}
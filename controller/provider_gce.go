@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"tag-label-sync.io/gce"
+	"tag-label-sync.io/gce/instances"
+)
+
+// GCEInstance is the resource type of nodes on GCE.
+const GCEInstance string = "instance"
+
+// GCE labels are much stricter than tags: keys must start with a lowercase letter and can only have
+// lowercase letters, digits, '_' and '-', and values the same without the first rule, each up to 63
+// characters. A tag name that isn't a valid key is written as a key starting with "k8s_" followed by
+// the name with each byte other than a lowercase letter, a digit or '-' written as '_' and two hex
+// digits, e.g. tag "Team" becomes label "k8s__54eam". Keys are decoded the other way when read, so the
+// rest of the controller only ever sees tag names. Values can't be encoded without making them too
+// long to be useful, so tags with values outside the grammar are filtered.
+const gceKeyMarker string = "k8s_"
+
+var (
+	gceLabelKeyRegexp   = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+	gceLabelValueRegexp = regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+)
+
+// GCETagLimits are the limits on the labels of GCE instances. Labels starting with "goog-" belong to
+// Google Cloud.
+var GCETagLimits = TagLimits{
+	MaxTags:          64,
+	MaxNameLen:       maxLabelNameLen,
+	MaxValueLen:      maxLabelValLen,
+	ReservedPrefixes: []string{"goog-"},
+	Valid: func(tagName, tagVal string) bool {
+		return gceLabelKeyRegexp.MatchString(encodeGCELabelKey(tagName)) && gceLabelValueRegexp.MatchString(tagVal)
+	},
+}
+
+// networkTagPrefix begins the names of the tags made from an instance's network tags.
+const networkTagPrefix string = "network-tag."
+
+// gceTagProvider syncs nodes with the labels of GCE instances.
+type gceTagProvider struct {
+	log logr.Logger
+	// clients creates the instances clients, or instances.NewClient if nil.
+	clients instances.ClientFactory
+}
+
+// gceObject is the instance the labels were read from, and the client to write them back with.
+type gceObject struct {
+	client   *instances.Client
+	instance *instances.Instance
+}
+
+func (p *gceTagProvider) Resolve(providerID string, configOptions ConfigOptions) (NodeResource, bool, error) {
+	instance, err := gce.ParseProviderID(providerID)
+	if err != nil {
+		return NodeResource{}, false, err
+	}
+	// the resource group and subscription filters only apply on Azure
+	return NodeResource{ProviderID: providerID, Type: GCEInstance, Name: instance.Name, ID: instance}, true, nil
+}
+
+func (p *gceTagProvider) ReadTags(ctx context.Context, resource NodeResource, configOptions ConfigOptions) (ResourceTags, error) {
+	id := resource.ID.(gce.Instance)
+	newClient := p.clients
+	if newClient == nil {
+		newClient = instances.NewClient
+	}
+	client, err := newClient(ctx, id.Project, id.Zone)
+	if err != nil {
+		return ResourceTags{}, fmt.Errorf("failed to create GCE instances client: %v", err)
+	}
+	instance, err := client.Get(ctx, id.Name)
+	if err != nil {
+		return ResourceTags{}, fmt.Errorf("failed to get instance: %v", err)
+	}
+
+	tags := make(map[string]string, len(instance.Labels))
+	for key, val := range instance.Labels {
+		tags[decodeGCELabelKey(key)] = val
+	}
+	var inherited map[string]string
+	if instance.Tags != nil && configOptions.Inherits(NetworkTags) {
+		inherited = make(map[string]string, len(instance.Tags.Items))
+		for _, item := range instance.Tags.Items {
+			inherited[networkTagPrefix+item] = ""
+		}
+	}
+
+	return ResourceTags{
+		Resource:      resource,
+		Tags:          tags,
+		InheritedTags: mergeTags(inherited),
+		Limits:        GCETagLimits,
+		Object:        &gceObject{client: client, instance: instance},
+	}, nil
+}
+
+func (p *gceTagProvider) WriteTags(ctx context.Context, tags ResourceTags, plan SyncPlan, configOptions ConfigOptions) error {
+	if !plan.TagsChanged() {
+		return nil
+	}
+	object := tags.Object.(*gceObject)
+	p.log.V(1).Info("applying labels to GCE instance", "instance", object.instance.Name,
+		"add", plan.TagsToAdd, "update", plan.TagsToUpdate, "remove", plan.TagsToRemove)
+
+	newTags := plan.ApplyToTags(tags.Tags)
+	labels := make(map[string]string, len(newTags))
+	for tagName, tagVal := range newTags {
+		labels[encodeGCELabelKey(tagName)] = tagVal
+	}
+	// setLabels replaces all of the labels, so it fails if they changed since they were read rather
+	// than lose the change; the node is requeued and synced with the new labels
+	if err := object.client.SetLabels(ctx, object.instance.Name, labels, object.instance.LabelFingerprint); err != nil {
+		if instances.IsPreconditionFailed(err) {
+			return fmt.Errorf("instance labels changed since they were read: %v", err)
+		}
+		return fmt.Errorf("failed to update instance labels: %v", err)
+	}
+	return nil
+}
+
+// encodeGCELabelKey returns the label key for a tag name. Names that are already valid keys are kept
+// unless decodeGCELabelKey would read them as something else.
+func encodeGCELabelKey(tagName string) string {
+	if gceLabelKeyRegexp.MatchString(tagName) {
+		if _, ok := unescapeGCELabelKey(tagName); !ok {
+			return tagName
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(gceKeyMarker)
+	for i := 0; i < len(tagName); i++ {
+		c := tagName[i]
+		if ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%c%02x", escapeChar, c)
+	}
+	return b.String()
+}
+
+// decodeGCELabelKey returns the tag name for a label key.
+func decodeGCELabelKey(key string) string {
+	if tagName, ok := unescapeGCELabelKey(key); ok {
+		return tagName
+	}
+	return key
+}
+
+// unescapeGCELabelKey reverses the escaping in encodeGCELabelKey. It returns false for keys that
+// encodeGCELabelKey wouldn't have produced, so that each tag has exactly one label key.
+func unescapeGCELabelKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, gceKeyMarker) {
+		return "", false
+	}
+	encoded := strings.TrimPrefix(key, gceKeyMarker)
+
+	var b strings.Builder
+	for i := 0; i < len(encoded); i++ {
+		c := encoded[i]
+		if c != escapeChar {
+			b.WriteByte(c)
+			continue
+		}
+		if i+2 >= len(encoded) {
+			return "", false
+		}
+		decoded, err := strconv.ParseUint(encoded[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", false
+		}
+		b.WriteByte(byte(decoded))
+		i += 2
+	}
+
+	// the name is shorter than the key, so this always ends
+	tagName := b.String()
+	if encodeGCELabelKey(tagName) != key {
+		return "", false
+	}
+	return tagName, true
+}
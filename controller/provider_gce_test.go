@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"tag-label-sync.io/gce/gcetest"
+)
+
+func TestGCELabelKeyRoundTrip(t *testing.T) {
+	var tests = []struct {
+		tagName string
+		key     string
+	}{
+		{tagName: "env", key: "env"},
+		{tagName: "node-pool_1", key: "node-pool_1"},
+		{tagName: "Team", key: "k8s__54eam"},
+		{tagName: "node.labels.topology.kubernetes.io:zone", key: "k8s_node_2elabels_2etopology_2ekubernetes_2eio_3azone"},
+		{tagName: "1st", key: "k8s_1st"},
+		// a valid key that happens to look encoded has to be encoded too
+		{tagName: "k8s_41", key: "k8s_k8s_5f41"},
+		// but one that doesn't decode can stay as it is
+		{tagName: "k8s_zz", key: "k8s_zz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tagName, func(t *testing.T) {
+			key := encodeGCELabelKey(tt.tagName)
+			if key != tt.key {
+				t.Errorf("encodeGCELabelKey(%q) = %q, want %q", tt.tagName, key, tt.key)
+			}
+			if tagName := decodeGCELabelKey(key); tagName != tt.tagName {
+				t.Errorf("decodeGCELabelKey(%q) = %q, want %q", key, tagName, tt.tagName)
+			}
+		})
+	}
+
+	// every label a user can set reads back as the same label when written
+	for _, key := range []string{"k8s_", "k8s__41", "k8s_a_2d", "k8s_k8s_", "a_b"} {
+		if got := encodeGCELabelKey(decodeGCELabelKey(key)); got != key {
+			t.Errorf("label %q is written back as %q", key, got)
+		}
+	}
+}
+
+func TestGCETagLimits(t *testing.T) {
+	var tests = []struct {
+		tagName string
+		tagVal  string
+		allowed bool
+	}{
+		{tagName: "env", tagVal: "prod", allowed: true},
+		{tagName: "Team", tagVal: "infra", allowed: true},
+		{tagName: "env", tagVal: "Prod", allowed: false},
+		{tagName: "version", tagVal: "1.2", allowed: false},
+		{tagName: "goog-managed", tagVal: "x", allowed: false},
+		{tagName: strings.Repeat("A", 20), tagVal: "x", allowed: false}, // too long once encoded
+	}
+
+	for _, tt := range tests {
+		if allowed := GCETagLimits.allows(tt.tagName, tt.tagVal); allowed != tt.allowed {
+			t.Errorf("allows(%q, %q) = %v, want %v", tt.tagName, tt.tagVal, allowed, tt.allowed)
+		}
+	}
+}
+
+// withGCEServer makes r call server for GCE instances.
+func withGCEServer(r *ReconcileTagLabelSync, server *gcetest.Server) {
+	r.Providers = DefaultTagProviders(r.Log, r.AzureClients)
+	r.Providers[GCEScheme] = &gceTagProvider{log: r.Log, clients: server.InstanceClients()}
+}
+
+func gceTestObjects() (*corev1.Node, *corev1.ConfigMap) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-0", Labels: map[string]string{
+			"rack":               "r1",
+			"gce.labels/Team":    "infra",
+			"gce.labels/version": "1.2", // not a valid GCE label value
+		}},
+		Spec: corev1.NodeSpec{ProviderID: "gce://my-project/us-central1-a/instance-1"},
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: ConfigMapNamespace},
+		Data: map[string]string{
+			"syncDirection": "two-way",
+			"labelPrefix":   "gce.labels",
+			"tagPrefix":     "node-labels",
+			"inheritFrom":   "network-tags",
+			"labelExclude":  "",
+		},
+	}
+	return node, configMap
+}
+
+func TestReconcileGCEInstance(t *testing.T) {
+	server := gcetest.NewServer()
+	defer server.Close()
+
+	server.Instances["instance-1"] = &gcetest.Instance{
+		Labels:      map[string]string{"env": "prod", "goog-gke-node": ""},
+		NetworkTags: []string{"web"},
+	}
+	node, configMap := gceTestObjects()
+	r := newTestReconciler(node, configMap)
+	withGCEServer(r, server)
+
+	if _, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "node-0"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got corev1.Node
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "node-0"}, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for label, want := range map[string]string{"gce.labels/env": "prod", "gce.labels/goog-gke-node": "", "gce.labels/network-tag.web": ""} {
+		if val, ok := got.Labels[label]; !ok || val != want {
+			t.Errorf("label %s = %q, want %q", label, val, want)
+		}
+	}
+	wantLabels := map[string]string{
+		"env":                    "prod",
+		"goog-gke-node":          "",
+		"k8s__54eam":             "infra",
+		"k8s_node-labels_2erack": "r1",
+	}
+	if labels := server.InstanceLabels("instance-1"); !reflect.DeepEqual(labels, wantLabels) {
+		t.Errorf("instance labels = %v, want %v", labels, wantLabels)
+	}
+	if server.Requests["setLabels"] != 1 || server.Requests["wait"] != 1 {
+		t.Errorf("requests = %v, want one setLabels waited on once", server.Requests)
+	}
+}
+
+func TestReconcileGCEInstanceLabelsChanged(t *testing.T) {
+	server := gcetest.NewServer()
+	defer server.Close()
+
+	server.Instances["instance-1"] = &gcetest.Instance{Labels: map[string]string{"env": "prod"}}
+	server.BeforeSetLabels = func(instance *gcetest.Instance) {
+		instance.Labels = map[string]string{"env": "prod", "owner": "someone-else"}
+	}
+	node, configMap := gceTestObjects()
+	r := newTestReconciler(node, configMap)
+	withGCEServer(r, server)
+
+	if _, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "node-0"}}); err == nil {
+		t.Fatalf("expected an error when the labels changed since they were read")
+	}
+	want := map[string]string{"env": "prod", "owner": "someone-else"}
+	if labels := server.InstanceLabels("instance-1"); !reflect.DeepEqual(labels, want) {
+		t.Errorf("instance labels = %v, want the other change kept: %v", labels, want)
+	}
+}
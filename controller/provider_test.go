@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// fakeTagProvider keeps the tags of each resource in memory, keyed by provider ID.
+type fakeTagProvider struct {
+	tags map[string]map[string]string
+}
+
+func (p *fakeTagProvider) Resolve(providerID string, configOptions ConfigOptions) (NodeResource, bool, error) {
+	return NodeResource{ProviderID: providerID, Type: "fake", Name: providerID}, true, nil
+}
+
+func (p *fakeTagProvider) ReadTags(ctx context.Context, resource NodeResource, configOptions ConfigOptions) (ResourceTags, error) {
+	return ResourceTags{Resource: resource, Tags: p.tags[resource.ProviderID]}, nil
+}
+
+func (p *fakeTagProvider) WriteTags(ctx context.Context, tags ResourceTags, plan SyncPlan, configOptions ConfigOptions) error {
+	p.tags[tags.Resource.ProviderID] = plan.ApplyToTags(tags.Tags)
+	return nil
+}
+
+func TestProviderScheme(t *testing.T) {
+	tests := map[string]string{
+		"azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm": AzureScheme,
+		"aws:///us-west-2a/i-0123456789abcdef0":                                                       AWSScheme,
+		"gce://project/us-central1-a/instance":                                                        GCEScheme,
+		"Azure:///subscriptions/sub":                                                                  AzureScheme,
+		"kind://docker/kind/kind-worker":                                                              "kind",
+		"":                                                                                            "",
+	}
+	for providerID, want := range tests {
+		if got := providerScheme(providerID); got != want {
+			t.Errorf("providerScheme(%q) = %q, want %q", providerID, got, want)
+		}
+	}
+}
+
+func TestReconcileWithTagProvider(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-0", Labels: map[string]string{"rack": "r1"}},
+		Spec:       corev1.NodeSpec{ProviderID: "fake://node-0"},
+	}
+	provider := &fakeTagProvider{tags: map[string]map[string]string{"fake://node-0": {"env": "prod"}}}
+	r := newTestReconciler(node)
+	r.Providers = map[string]TagProvider{"fake": provider}
+
+	if _, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "node-0"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got corev1.Node
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "node-0"}, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Labels["azure.tags/env"] != "prod" {
+		t.Errorf("labels = %v, want azure.tags/env=prod", got.Labels)
+	}
+
+	if _, err := r.tagProvider("azure:///subscriptions/sub"); err == nil {
+		t.Errorf("expected an error for a scheme without a provider")
+	}
+}
+
+func TestAzureTagProviderResolve(t *testing.T) {
+	const providerID = "azure:///subscriptions/sub/resourceGroups/MC_rg/providers/Microsoft.Compute/virtualMachineScaleSets/vmss/virtualMachines/3"
+	p := &azureTagProvider{}
+
+	resource, selected, err := p.Resolve(providerID, ConfigOptions{ResourceGroupFilter: []string{"mc_*"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !selected || resource.Type != VMSS || resource.Name != "vmss" {
+		t.Errorf("Resolve() = %+v, %v, want the selected scale set", resource, selected)
+	}
+	if _, selected, _ := p.Resolve(providerID, ConfigOptions{SubscriptionFilter: []string{"other"}}); selected {
+		t.Errorf("Resolve() selected a resource outside the subscription filter")
+	}
+
+	resource, _, err = p.Resolve("azure:///subscriptions/sub/resourceGroups/rg/providers/microsoft.compute/virtualmachines/node-0", ConfigOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resource.Type != VM || resource.Name != "node-0" {
+		t.Errorf("Resolve() = %+v, want the VM", resource)
+	}
+	if _, _, err := p.Resolve("azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/disk-0", ConfigOptions{}); err == nil {
+		t.Errorf("Resolve() accepted a disk")
+	}
+}
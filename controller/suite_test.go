@@ -16,6 +16,7 @@ limitations under the License.
 package controller
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -29,6 +30,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	taglabelv1 "tag-label-sync.io/api/v1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -40,6 +43,9 @@ var k8sClient client.Client
 var testEnv *envtest.Environment
 
 func TestAPIs(t *testing.T) {
+	if envtestAssetsMissing() {
+		t.Skip("no kube-apiserver and etcd to run envtest with, run `make test` or set KUBEBUILDER_ASSETS")
+	}
 	RegisterFailHandler(Fail)
 
 	RunSpecsWithDefaultAndCustomReporters(t,
@@ -47,6 +53,20 @@ func TestAPIs(t *testing.T) {
 		[]Reporter{envtest.NewlineReporter{}})
 }
 
+// envtestAssetsMissing is true if envtest would fail to start because the binaries it runs aren't
+// where it looks for them, and there's no existing cluster to use instead.
+func envtestAssetsMissing() bool {
+	if os.Getenv("USE_EXISTING_CLUSTER") == "true" || os.Getenv("TEST_ASSET_KUBE_APISERVER") != "" {
+		return false
+	}
+	dir := os.Getenv("KUBEBUILDER_ASSETS")
+	if dir == "" {
+		dir = "/usr/local/kubebuilder/bin"
+	}
+	_, err := os.Stat(filepath.Join(dir, "kube-apiserver"))
+	return err != nil
+}
+
 var _ = BeforeSuite(func(done Done) {
 	logf.SetLogger(zap.LoggerTo(GinkgoWriter, true))
 
@@ -63,6 +83,9 @@ var _ = BeforeSuite(func(done Done) {
 	err = appsv1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = taglabelv1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	// +kubebuilder:scaffold:scheme
 
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
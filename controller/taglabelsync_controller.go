@@ -2,37 +2,53 @@ package controller
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	"tag-label-sync.io/azure"
-	"tag-label-sync.io/azure/scalesets"
-	"tag-label-sync.io/azure/vms"
+	taglabelv1 "tag-label-sync.io/api/v1"
 )
 
-const (
-	VM   string = "virtualMachines"
-	VMSS string = "virtualMachineScaleSets"
-)
+const requeueJitterFactor float64 = 0.1
+
+// policyCacheKeyPrefix starts the configCache keys of TagLabelSyncConfigs.
+const policyCacheKeyPrefix string = "TagLabelSyncConfig/"
 
 type ReconcileTagLabelSync struct {
 	client.Client
 	Log      logr.Logger
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
-	ctx      context.Context
+	// Providers are the tag providers keyed by provider ID scheme. SetupWithManager sets them to the
+	// DefaultTagProviders if nil.
+	Providers map[string]TagProvider
+	// AzureClients create the Azure clients of the default providers.
+	AzureClients AzureClients
+	ctx          context.Context
+
+	configCache configCache
 }
 
-// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;create;update;patch;delete
+// +kubebuilder:rbac:groups=taglabel.tag-label-sync.io,resources=taglabelsyncconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=taglabel.tag-label-sync.io,resources=taglabelsyncconfigs/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=nodes/status,verbs=get
 
@@ -41,194 +57,327 @@ func (r *ReconcileTagLabelSync) Reconcile(request reconcile.Request) (reconcile.
 	log := r.Log.WithValues("tag-label-sync", request.NamespacedName)
 	r.ctx = ctx
 
-	var configMap corev1.ConfigMap
-	var configOptions ConfigOptions
-	optionsNamespacedName := types.NamespacedName{Name: "tag-label-sync", Namespace: "default"} // is this okay
-	if err := r.Get(ctx, optionsNamespacedName, &configMap); err != nil {
-		log.V(1).Info("unable to fetch ConfigMap, instead using default configuration settings")
-		// should I allow this to continue? It would be unfortunate to have things sync and then clean it up
-		configOptions = DefaultConfigOptions()
-	} else {
-		configOptions, err = NewConfigOptions(configMap) // ConfigMap.Data is string -> string but I don't always want that
-		if err != nil {
-			log.Error(err, "failed to load options from config file")
-			return ctrl.Result{}, err
-		}
-	}
-
 	var node corev1.Node
 	if err := r.Get(ctx, request.NamespacedName, &node); err != nil {
 		log.Error(err, "unable to fetch Node")
 		return ctrl.Result{}, err // what should I return here?
 	}
+
+	configOptions, ok, err := r.loadConfigOptions(ctx, log, &node)
+	if err != nil {
+		log.Error(err, "failed to load options")
+		return ctrl.Result{}, err
+	}
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+
 	log.V(1).Info("provider info", "provider ID", node.Spec.ProviderID)
-	provider, err := azure.ParseProviderID(node.Spec.ProviderID)
+	provider, err := r.tagProvider(node.Spec.ProviderID)
+	if err != nil {
+		log.Error(err, "unsupported provider ID")
+		return ctrl.Result{}, nil
+	}
+	resource, selected, err := provider.Resolve(node.Spec.ProviderID, configOptions)
 	if err != nil {
 		log.Error(err, "invalid provider ID")
+		return ctrl.Result{}, nil
+	}
+	if !selected {
+		log.V(1).Info("node is outside the resource filters, skipping", "resource", resource.Name)
+		return ctrl.Result{}, nil
 	}
 
-	switch provider.ResourceType {
-	case VMSS:
-		// Get VMSS client
-		vmssClient, err := scalesets.NewClient(provider.SubscriptionID, provider.ResourceGroup)
-		if err != nil {
-			log.Error(err, "failed to create VMSS client")
-		}
-		vmss, err := vmssClient.Get(ctx, provider.ResourceName)
+	tags, err := provider.ReadTags(ctx, resource, configOptions)
+	if err != nil {
+		log.Error(err, "failed to read tags", "resource type", resource.Type, "resource", resource.Name)
+		return ctrl.Result{}, err
+	}
+	plan, err := r.syncNodeLabels(request, &node, tags.state(), configOptions)
+	if err != nil {
+		log.Error(err, "failed to apply tags to nodes")
+		return ctrl.Result{}, err
+	}
+	if err := provider.WriteTags(ctx, tags, plan, configOptions); err != nil {
+		log.Error(err, "failed to write tags", "resource type", resource.Type, "resource", resource.Name)
+		return ctrl.Result{}, err
+	}
+	if err := r.propagateTags(log, &node, provider, tags, plan, configOptions); err != nil {
+		log.Error(err, "failed to apply labels to attached resources", "resource type", resource.Type, "resource", resource.Name)
+		return ctrl.Result{}, err
+	}
+
+	// tag changes in the cloud don't cause any event, so check again after the interval
+	return ctrl.Result{RequeueAfter: requeueAfter(configOptions)}, nil
+}
+
+// requeueAfter is the configured interval with up to 10% added, so nodes synced together
+// don't all call ARM at the same time on every interval.
+func requeueAfter(configOptions ConfigOptions) time.Duration {
+	return wait.Jitter(configOptions.Interval, requeueJitterFactor)
+}
+
+// loadConfigOptions reads options from the TagLabelSyncConfig that applies to the node, and returns
+// false if the node shouldn't be synced: there are TagLabelSyncConfigs but none select it, or the
+// options are invalid. If there are none at all, the tag-label-sync ConfigMap is used instead, and if
+// there's no ConfigMap either the defaults are used.
+func (r *ReconcileTagLabelSync) loadConfigOptions(ctx context.Context, log logr.Logger, node *corev1.Node) (ConfigOptions, bool, error) {
+	var policies taglabelv1.TagLabelSyncConfigList
+	err := r.List(ctx, &policies)
+	if err != nil && !meta.IsNoMatchError(err) {
+		return ConfigOptions{}, false, err
+	}
+	if err == nil && len(policies.Items) > 0 {
+		r.pruneConfigCache(policies.Items)
+		matching, err := matchingPolicies(node, policies.Items)
 		if err != nil {
-			log.Error(err, "failed to get VMSS")
+			return ConfigOptions{}, false, err
 		}
-
-		// Add VMSS tags to node
-		if err := r.applyVMSSTagsToNodes(request, vmss, &node, vmssClient, configOptions); err != nil {
-			log.Error(err, "failed to apply tags to nodes")
-			return reconcile.Result{}, err
+		if len(matching) == 0 {
+			log.V(1).Info("node is not selected by any TagLabelSyncConfig, skipping")
+			return ConfigOptions{}, false, nil
 		}
-	case VM:
-		// Get VM Client
-		vmClient, err := vms.NewClient(provider.SubscriptionID, provider.ResourceGroup)
-		if err != nil {
-			log.Error(err, "failed to create VM client")
+		config := matching[0]
+		if len(matching) > 1 {
+			r.recordOverlappingPolicies(node, matching)
 		}
-		vm, err := vmClient.Get(ctx, provider.ResourceName)
+		log.V(1).Info("using TagLabelSyncConfig", "name", config.Name)
+
+		configOptions, err := r.parseConfigOptions(log, policyCacheKeyPrefix+config.Name, &config, config.ResourceVersion, func() (ConfigOptions, error) {
+			return NewConfigOptionsFromSpec(config.Spec)
+		})
 		if err != nil {
-			log.Error(err, "failed to get VM")
+			return ConfigOptions{}, false, nil
 		}
+		r.updateObservedGeneration(ctx, log, &config)
+		return configOptions, true, nil
+	}
 
-		// Add VM tags to node
-		if err := r.applyVMTagsToNodes(request, vm, &node, vmClient, configOptions); err != nil {
-			log.Error(err, "failed to apply tags to nodes")
-		}
-	default:
-		log.V(1).Info("unrecognized resource type", "resource type", provider.ResourceType)
+	var configMap corev1.ConfigMap
+	optionsNamespacedName := types.NamespacedName{Name: ConfigMapName, Namespace: ConfigMapNamespace}
+	if err := r.Get(ctx, optionsNamespacedName, &configMap); err != nil {
+		log.V(1).Info("unable to fetch TagLabelSyncConfig or ConfigMap, instead using default configuration settings")
+		// should I allow this to continue? It would be unfortunate to have things sync and then clean it up
+		return DefaultConfigOptions(), true, nil
 	}
+	log.V(1).Info("using options from ConfigMap, consider moving them to a TagLabelSyncConfig", "ConfigMap", optionsNamespacedName)
+	configOptions, err := r.parseConfigOptions(log, "ConfigMap/"+optionsNamespacedName.String(), &configMap, configMap.ResourceVersion, func() (ConfigOptions, error) {
+		return NewConfigOptions(configMap)
+	})
+	if err != nil {
+		return ConfigOptions{}, false, nil
+	}
+	return configOptions, true, nil
+}
 
-	return ctrl.Result{}, nil
+// parseConfigOptions parses options from a config object, or returns them from the cache if the
+// object hasn't changed since. Invalid options are reported when they're first parsed.
+func (r *ReconcileTagLabelSync) parseConfigOptions(log logr.Logger, key string, config runtime.Object, resourceVersion string, parse func() (ConfigOptions, error)) (ConfigOptions, error) {
+	if entry, ok := r.configCache.get(key, resourceVersion); ok {
+		return entry.configOptions, entry.err
+	}
+	configOptions, err := parse()
+	if err != nil {
+		r.recordInvalidConfig(log, config, err)
+	}
+	r.configCache.set(key, resourceVersion, configOptions, err)
+	return configOptions, err
 }
 
-// pass VMSS -> tags info and assign to nodes on VMs (unless node already has label)
-func (r *ReconcileTagLabelSync) applyVMSSTagsToNodes(request reconcile.Request, vmss *scalesets.Spec, node *corev1.Node, vmssClient *scalesets.Client, configOptions ConfigOptions) error {
-	log := r.Log.WithValues("tag-label-sync", request.NamespacedName)
-	// each VMSS may have multiple nodes, but I think each nodes is only in one VMSS
-	// whats the fastest way to check if Node already has label? benefit of map
+// updateObservedGeneration records in the TagLabelSyncConfig's status that its current generation
+// was read. Only a changed generation is written, and as a merge patch, so the nodes a config selects
+// don't conflict with each other or write the same status again.
+func (r *ReconcileTagLabelSync) updateObservedGeneration(ctx context.Context, log logr.Logger, config *taglabelv1.TagLabelSyncConfig) {
+	if config.Status.ObservedGeneration == config.Generation {
+		return
+	}
+	patch := client.MergeFrom(config.DeepCopy())
+	config.Status.ObservedGeneration = config.Generation
+	if err := r.Status().Patch(ctx, config, patch); err != nil {
+		log.Error(err, "failed to update TagLabelSyncConfig status")
+	}
+}
+
+// pruneConfigCache drops the options cached for TagLabelSyncConfigs that no longer exist.
+func (r *ReconcileTagLabelSync) pruneConfigCache(policies []taglabelv1.TagLabelSyncConfig) {
+	keys := make(map[string]bool, len(policies))
+	for _, policy := range policies {
+		keys[policyCacheKeyPrefix+policy.Name] = true
+	}
+	r.configCache.prune(policyCacheKeyPrefix, keys)
+}
 
-	// assign all tags on VMSS to Node, if not already there
+// recordInvalidConfig raises an event on the ConfigMap or TagLabelSyncConfig that has invalid options.
+// err lists every rejected field.
+func (r *ReconcileTagLabelSync) recordInvalidConfig(log logr.Logger, config runtime.Object, err error) {
+	log.Error(err, "invalid options, not syncing")
+	r.Recorder.Event(config, "Warning", "InvalidConfiguration",
+		fmt.Sprintf("options were rejected and nodes are not being synced: %v", err))
+}
+
+// recordOverlappingPolicies raises an event when more than one TagLabelSyncConfig selects a node.
+// policies are in order of precedence, so only the first one is used.
+func (r *ReconcileTagLabelSync) recordOverlappingPolicies(node *corev1.Node, policies []taglabelv1.TagLabelSyncConfig) {
+	ignored := make([]string, 0, len(policies)-1)
+	for _, policy := range policies[1:] {
+		ignored = append(ignored, policy.Name)
+	}
+	r.Recorder.Event(node, "Warning", "OverlappingTagLabelSyncConfigs",
+		fmt.Sprintf("node is selected by more than one TagLabelSyncConfig, using '%s' and ignoring %s.", policies[0].Name, strings.Join(ignored, ", ")))
+}
+
+// syncNodeLabels computes the plan for a node and the tags in state, raises conflict events and
+// patches the node's labels. If the node changed since it was read, it's read again and planned from
+// scratch. The returned plan still has to be applied to the ARM resource.
+func (r *ReconcileTagLabelSync) syncNodeLabels(request reconcile.Request, node *corev1.Node, state SyncState, configOptions ConfigOptions) (SyncPlan, error) {
+	log := r.Log.WithValues("tag-label-sync", request.NamespacedName)
 	log.V(0).Info("configOptions", "sync direction", configOptions.SyncDirection)
-	if configOptions.SyncDirection == TwoWay || configOptions.SyncDirection == ARMToNode {
-		for tagName, tagVal := range vmss.Spec().Tags {
-			// what if key exists but different value? what takes priority? currently just going to ignore and only add tags that don't exist
-			labelVal, ok := node.Labels[ConvertTagNameToValidLabelName(tagName, configOptions)]
-			if !ok {
-				// add tag as label
-				log.V(1).Info("applying tags to nodes", "tagName", tagName, "tagVal", *tagVal)
-
-				node.Labels[ConvertTagNameToValidLabelName(tagName, configOptions)] = *tagVal
-				if err := r.Update(r.ctx, node); err != nil { // should this be a patch?
-					return err
-				}
-			} else if labelVal != *tagVal {
-				log.V(0).Info("updating", "using policy", configOptions.ConflictPolicy)
-				switch configOptions.ConflictPolicy {
-				case ARMPrecedence:
-					// set label anyway
-					node.Labels[ConvertTagNameToValidLabelName(tagName, configOptions)] = *tagVal
-					if err := r.Update(r.ctx, node); err != nil {
-						return err
-					}
-				case NodePrecedence:
-					// do nothing
-					log.V(0).Info("name->value conflict found", "node label value", labelVal, "ARM tag value", *tagVal)
-				case Ignore:
-					// raise k8s event
-					r.Recorder.Event(node, "Warning", "ConflictingTagLabelValues",
-						fmt.Sprintf("ARM tag was not applied to node because a different value for '%s' already exists (%s != %s).", tagName, *tagVal, labelVal))
-					log.V(0).Info("name->value conflict found, leaving unchanged", "label value", labelVal, "tag value", *tagVal)
-				default:
-					return errors.New("unrecognized conflict policy")
-				}
+
+	var plan SyncPlan
+	reread := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if reread {
+			if err := r.Get(r.ctx, request.NamespacedName, node); err != nil {
+				return err
 			}
 		}
+		reread = true
+
+		var err error
+		if plan, err = ComputeSyncPlan(nodeSyncState(log, node, state), configOptions); err != nil {
+			return err
+		}
+		return r.patchNodeLabels(node, plan, configOptions)
+	})
+	if err != nil {
+		return SyncPlan{}, err
 	}
 
-	// assign all labels on Node to VMSS, if not already there
+	r.recordConflicts(request, node, plan, configOptions)
+	r.recordFiltered(request, node, plan)
+	r.recordSanitized(node, plan, configOptions)
+	for _, t := range plan.InvalidTaints {
+		r.Recorder.Event(node, "Warning", "InvalidTaintTag",
+			fmt.Sprintf("ARM tag '%s' was not applied as a taint: %s.", t.TagName, t.Reason))
+	}
 
-	if configOptions.SyncDirection == TwoWay || configOptions.SyncDirection == NodeToARM {
-		if len(vmss.Spec().Tags) > maxNumTags {
-			// error
-			log.V(1).Info("can't add any more tags", "number of tags", len(vmss.Spec().Tags))
-			return nil
-		}
-		for labelName, labelVal := range node.Labels {
-			if !ValidTagName(labelName, configOptions) {
-				// I don't think I want to retuern yet
-				// return errors.New(fmt.Sprintf("invalid tag name: %s", labelName))
-				// log.Error(errors.New(fmt.Sprintf("invalid tag name")), fmt.Sprintf("label name: %s", labelName))
-				log.V(0).Info("invalid tag name", "label name", labelName)
-				continue
-			}
-			validTagName := ConvertLabelNameToValidTagName(labelName, configOptions)
-			tagVal, ok := vmss.Spec().Tags[validTagName]
-			if !ok {
-				// add label as tag
-				log.V(1).Info("applying labels to VMSS", "labelVal", labelVal, "tagVal", tagVal)
-
-				vmss.Spec().Tags[validTagName] = &labelVal
-				if err := vmssClient.Update(r.ctx, *vmss.Spec().Name, vmss); err != nil {
-					// log.Error(err, "failed to update VMSS", "labelName", validTagName, "labelVal", labelVal)
-					log.Error(err, "failed to update VMSS", "labelName", labelName, "labelVal", labelVal)
-				}
-			} else if *tagVal != labelVal {
-				switch configOptions.ConflictPolicy {
-				case NodePrecedence:
-					// set tag anyway
-					vmss.Spec().Tags[validTagName] = &labelVal
-					if err := vmssClient.Update(r.ctx, *vmss.Spec().Name, vmss); err != nil {
-						// log.Error(err, "failed to update VMSS", "labelName", validTagName, "labelVal", labelVal)
-						log.Error(err, "failed to update VMSS", "labelName", labelName, "labelVal", labelVal)
-					}
-				case ARMPrecedence:
-					// do nothing
-					log.V(0).Info("name->value conflict found", "node label value", labelVal, "ARM tag value", *tagVal)
-				case Ignore:
-					// raise kubernetes event
-					r.Recorder.Event(node, "Warning", "ConflictingTagLabelValues",
-						fmt.Sprintf("node label was not applied to VMSS because a different value for '%s' already exists (%s != %s).", labelName, labelVal, *tagVal))
-					log.V(0).Info("name->value conflict found, leaving unchanged", "label value", labelVal, "tag value", *tagVal)
-				default:
-					return errors.New("unrecognized conflict policy")
-				}
-			}
-		}
+	if plan.LabelsChanged() {
+		log.V(1).Info("applied tags to node", "add", plan.LabelsToAdd, "update", plan.LabelsToUpdate, "remove", plan.LabelsToRemove)
+	}
+	if plan.TaintsChanged() {
+		log.V(1).Info("applied tags to node taints", "taints", plan.Taints)
+	}
+	if plan.AnnotationsChanged() {
+		log.V(1).Info("applied tags to node annotations", "add", plan.AnnotationsToAdd, "update", plan.AnnotationsToUpdate, "remove", plan.AnnotationsToRemove)
 	}
 
-	return nil
+	return plan, nil
 }
 
-func (r *ReconcileTagLabelSync) applyVMTagsToNodes(request reconcile.Request, vm *vms.Spec, node *corev1.Node, vmClient *vms.Client, configOptions ConfigOptions) error {
-	log := r.Log.WithValues("tag-label-sync", request.NamespacedName)
+// nodeSyncState adds the node's labels, annotations and taints, and its records of them, to the tags in state.
+func nodeSyncState(log logr.Logger, node *corev1.Node, state SyncState) SyncState {
+	managed, err := managedKeys(node)
+	if err != nil {
+		// start over rather than getting stuck, the worst case is that stale keys are left behind
+		log.Error(err, "invalid annotation, ignoring previously managed labels and tags", "annotation", LastAppliedAnnotation)
+	}
+	originalTags, err := originals(node)
+	if err != nil {
+		log.Error(err, "invalid annotation, ignoring originals of shortened labels", "annotation", OriginalsAnnotation)
+	}
+	state.Labels = node.Labels
+	state.Annotations = node.Annotations
+	state.Taints = node.Spec.Taints
+	state.Managed = managed
+	state.Originals = originalTags
+	return state
+}
 
-	for tagName, tagVal := range vm.Spec().Tags {
-		labelVal, ok := node.Labels[tagName]
-		if !ok {
-			// add tag as label
-			log.V(1).Info("applying tags to nodes", "tagName", tagName, "tagVal", *tagVal)
+// recordConflicts raises an event for each conflict left by the plan when the policy is to ignore them
+func (r *ReconcileTagLabelSync) recordConflicts(request reconcile.Request, node *corev1.Node, plan SyncPlan, configOptions ConfigOptions) {
+	log := r.Log.WithValues("tag-label-sync", request.NamespacedName)
+	for _, c := range plan.Conflicts {
+		if configOptions.ConflictPolicy != Ignore {
+			log.V(0).Info("name->value conflict found", "node label value", c.LabelVal, "ARM tag value", c.TagVal)
+			continue
+		}
+		if c.Direction == ARMToNode {
+			r.Recorder.Event(node, "Warning", "ConflictingTagLabelValues",
+				fmt.Sprintf("ARM tag was not applied to node because a different value for '%s' already exists (%s != %s).", c.TagName, c.TagVal, c.LabelVal))
+		} else {
+			r.Recorder.Event(node, "Warning", "ConflictingTagLabelValues",
+				fmt.Sprintf("node %s was not applied to ARM resource because a different value for '%s' already exists (%s != %s).", c.Target, c.LabelName, c.LabelVal, c.TagVal))
+		}
+		log.V(0).Info("name->value conflict found, leaving unchanged", "label value", c.LabelVal, "tag value", c.TagVal)
+	}
+}
 
-			node.Labels[tagName] = *tagVal
-			err := r.Update(context.TODO(), node) // should this be a patch?
-			if err != nil {
-				return err
-			}
-		} else if labelVal != *tagVal {
-			// TODO
-			return errors.New(fmt.Sprintf("Label already exists on node %s but with different value", node.Name))
+// recordFiltered counts the keys left out by each key filter rule, and raises an event for each key
+// that didn't fit within the resource's tag limits, since unlike a filter nobody chose to leave it out
+func (r *ReconcileTagLabelSync) recordFiltered(request reconcile.Request, node *corev1.Node, plan SyncPlan) {
+	log := r.Log.WithValues("tag-label-sync", request.NamespacedName)
+	counts := map[FilteredKey]int{}
+	for _, f := range plan.Filtered {
+		counts[FilteredKey{Direction: f.Direction, Rule: f.Rule}]++
+		if f.Rule == tagLimitsRule {
+			r.Recorder.Event(node, "Warning", "TagLimitExceeded",
+				fmt.Sprintf("'%s' was not applied to ARM because the tag would be outside the resource's tag limits.", f.Key))
 		}
 	}
+	for rule, count := range counts {
+		filteredKeys.WithLabelValues(string(rule.Direction), rule.Rule).Add(float64(count))
+		log.V(1).Info("keys filtered", "direction", rule.Direction, "rule", rule.Rule, "count", count)
+	}
+}
 
-	return nil
+// recordSanitized raises an event for each tag skipped because of its value, and for each label being
+// given a sanitized value, so that one bad value is reported without holding up the other keys
+func (r *ReconcileTagLabelSync) recordSanitized(node *corev1.Node, plan SyncPlan, configOptions ConfigOptions) {
+	for _, v := range plan.Sanitized {
+		if v.Skipped {
+			r.Recorder.Event(node, "Warning", "SkippedTagValue",
+				fmt.Sprintf("ARM tag '%s' was not applied to node because its value %q is not a valid label value.", v.TagName, v.TagVal))
+			continue
+		}
+		_, add := plan.LabelsToAdd[v.LabelName]
+		_, update := plan.LabelsToUpdate[v.LabelName]
+		if add || update {
+			r.Recorder.Event(node, "Normal", "SanitizedTagValue",
+				fmt.Sprintf("value %q of ARM tag '%s' is not a valid label value, so label '%s' was set to %q (%s).",
+					v.TagVal, v.TagName, v.LabelName, v.LabelVal, configOptions.ValuePolicy))
+		}
+	}
 }
 
+// SetupWithManager creates the controller and its watches. The builder can't set predicates on a
+// single watch, so the controller is created directly.
 func (r *ReconcileTagLabelSync) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Node{}).
-		Complete(r)
+	if r.Providers == nil {
+		// created once so the providers' clients are shared by every reconcile
+		r.Providers = DefaultTagProviders(r.Log, r.AzureClients)
+	}
+	c, err := controller.New("node", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+	if err := c.Watch(&source.Kind{Type: &corev1.Node{}}, &handler.EnqueueRequestForObject{}); err != nil {
+		return err
+	}
+	if err := c.Watch(&source.Kind{Type: &corev1.ConfigMap{}},
+		&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.configMapToNodes)}); err != nil {
+		return err
+	}
+
+	// the ConfigMap still works without the TagLabelSyncConfig CRD, so only watch it if it's installed
+	gk := schema.GroupKind{Group: taglabelv1.GroupVersion.Group, Kind: "TagLabelSyncConfig"}
+	if _, err := mgr.GetRESTMapper().RESTMapping(gk, taglabelv1.GroupVersion.Version); err == nil {
+		return c.Watch(&source.Kind{Type: &taglabelv1.TagLabelSyncConfig{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.policyToNodes)},
+			generationChangedPredicate)
+	} else if meta.IsNoMatchError(err) {
+		r.Log.Info("TagLabelSyncConfig CRD is not installed, only the ConfigMap will be watched")
+		return nil
+	} else {
+		return err
+	}
 }
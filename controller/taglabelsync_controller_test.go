@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"tag-label-sync.io/azure/azuretest"
+)
+
+// syncResult is what a node's labels and its VM's tags end up as after a reconcile.
+type syncResult struct {
+	labels map[string]string
+	tags   map[string]string
+}
+
+// reconcileAgainstServer syncs a node on a VM served by server, where the VM's tag "env" and the node's
+// label for it have different values, and each has one key the other doesn't.
+func reconcileAgainstServer(ctx context.Context, c client.Client, server *azuretest.Server, nodeName string) (syncResult, error) {
+	vm := testResourceGroup + "virtualMachines/" + nodeName
+	server.Put(vm, map[string]string{"env": "prod", "team": "infra"})
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName, Labels: map[string]string{"azure.tags/env": "dev", "rack": "r1"}},
+		Spec:       corev1.NodeSpec{ProviderID: "azure://" + vm},
+	}
+	if err := c.Create(ctx, node); err != nil {
+		return syncResult{}, err
+	}
+	defer c.Delete(ctx, node)
+
+	r := &ReconcileTagLabelSync{
+		Client:    c,
+		Log:       logf.Log.WithName(nodeName),
+		Scheme:    scheme.Scheme,
+		Recorder:  record.NewFakeRecorder(10),
+		Providers: DefaultTagProviders(logf.Log.WithName(nodeName), serverClients(server)),
+	}
+	if _, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: nodeName}}); err != nil {
+		return syncResult{}, err
+	}
+
+	var got corev1.Node
+	if err := c.Get(ctx, types.NamespacedName{Name: nodeName}, &got); err != nil {
+		return syncResult{}, err
+	}
+	return syncResult{labels: got.Labels, tags: server.Tags(vm)}, nil
+}
+
+// syncCase is a sync direction and conflict policy, and what reconcileAgainstServer should end up with.
+type syncCase struct {
+	name      string
+	direction SyncDirection
+	policy    ConflictPolicy
+	want      syncResult
+}
+
+var syncCases = []syncCase{
+	// tags are only copied to labels, and a label that differs is only overwritten with ARM precedence
+	{name: "arm-to-node, arm-precedence", direction: ARMToNode, policy: ARMPrecedence, want: syncResult{
+		labels: map[string]string{"azure.tags/env": "prod", "azure.tags/team": "infra"},
+		tags:   map[string]string{"env": "prod", "team": "infra"},
+	}},
+	{name: "arm-to-node, node-precedence", direction: ARMToNode, policy: NodePrecedence, want: syncResult{
+		labels: map[string]string{"azure.tags/env": "dev", "azure.tags/team": "infra"},
+		tags:   map[string]string{"env": "prod", "team": "infra"},
+	}},
+	{name: "arm-to-node, ignore", direction: ARMToNode, policy: Ignore, want: syncResult{
+		labels: map[string]string{"azure.tags/env": "dev", "azure.tags/team": "infra"},
+		tags:   map[string]string{"env": "prod", "team": "infra"},
+	}},
+	// labels are only copied to tags, and a tag that differs is only overwritten with node precedence
+	{name: "node-to-arm, arm-precedence", direction: NodeToARM, policy: ARMPrecedence, want: syncResult{
+		labels: map[string]string{"azure.tags/env": "dev", "rack": "r1"},
+		tags:   map[string]string{"env": "prod", "team": "infra", "node.labels.rack": "r1"},
+	}},
+	{name: "node-to-arm, node-precedence", direction: NodeToARM, policy: NodePrecedence, want: syncResult{
+		labels: map[string]string{"azure.tags/env": "dev", "rack": "r1"},
+		tags:   map[string]string{"env": "dev", "team": "infra", "node.labels.rack": "r1"},
+	}},
+	{name: "node-to-arm, ignore", direction: NodeToARM, policy: Ignore, want: syncResult{
+		labels: map[string]string{"azure.tags/env": "dev", "rack": "r1"},
+		tags:   map[string]string{"env": "prod", "team": "infra", "node.labels.rack": "r1"},
+	}},
+	// both ways, the side with precedence wins the conflict, and with ignore neither side changes
+	{name: "two-way, arm-precedence", direction: TwoWay, policy: ARMPrecedence, want: syncResult{
+		labels: map[string]string{"azure.tags/env": "prod", "azure.tags/team": "infra", "rack": "r1"},
+		tags:   map[string]string{"env": "prod", "team": "infra", "node.labels.rack": "r1"},
+	}},
+	{name: "two-way, node-precedence", direction: TwoWay, policy: NodePrecedence, want: syncResult{
+		labels: map[string]string{"azure.tags/env": "dev", "azure.tags/team": "infra", "rack": "r1"},
+		tags:   map[string]string{"env": "dev", "team": "infra", "node.labels.rack": "r1"},
+	}},
+	{name: "two-way, ignore", direction: TwoWay, policy: Ignore, want: syncResult{
+		labels: map[string]string{"azure.tags/env": "dev", "azure.tags/team": "infra", "rack": "r1"},
+		tags:   map[string]string{"env": "prod", "team": "infra", "node.labels.rack": "r1"},
+	}},
+}
+
+func syncTableEntries() []TableEntry {
+	var entries []TableEntry
+	for _, c := range syncCases {
+		entries = append(entries, Entry(c.name, c.direction, c.policy, c.want))
+	}
+	return entries
+}
+
+// TestReconcileSyncDirections runs the same cases as the envtest specs against the fake client, so
+// they're checked even without a kube-apiserver.
+func TestReconcileSyncDirections(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range syncCases {
+		t.Run(tt.name, func(t *testing.T) {
+			server := azuretest.NewServer()
+			defer server.Close()
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: ConfigMapNamespace},
+				Data:       map[string]string{"syncDirection": string(tt.direction), "conflictPolicy": string(tt.policy), "labelExclude": ""},
+			}
+
+			got, err := reconcileAgainstServer(ctx, newTestReconciler(configMap).Client, server, "node-0")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for label, val := range tt.want.labels {
+				if got.labels[label] != val {
+					t.Errorf("labels = %v, want %s=%s", got.labels, label, val)
+				}
+			}
+			if _, ok := got.labels["azure.tags/team"]; ok && tt.direction == NodeToARM {
+				t.Errorf("labels = %v, want no tags copied to labels", got.labels)
+			}
+			if !reflect.DeepEqual(got.tags, tt.want.tags) {
+				t.Errorf("tags = %v, want %v", got.tags, tt.want.tags)
+			}
+		})
+	}
+}
+
+var _ = Describe("ReconcileTagLabelSync", func() {
+	var (
+		ctx       = context.Background()
+		server    *azuretest.Server
+		configMap *corev1.ConfigMap
+	)
+
+	BeforeEach(func() {
+		server = azuretest.NewServer()
+		configMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: ConfigMapNamespace}}
+	})
+
+	AfterEach(func() {
+		Expect(k8sClient.Delete(ctx, configMap)).To(Succeed())
+		server.Close()
+	})
+
+	DescribeTable("syncing a VM's tags with its node's labels",
+		func(direction SyncDirection, policy ConflictPolicy, want syncResult) {
+			configMap.Data = map[string]string{
+				"syncDirection":  string(direction),
+				"conflictPolicy": string(policy),
+				"labelExclude":   "",
+			}
+			Expect(k8sClient.Create(ctx, configMap)).To(Succeed())
+
+			got, err := reconcileAgainstServer(ctx, k8sClient, server, "node-"+string(direction)+"-"+string(policy))
+			Expect(err).NotTo(HaveOccurred())
+			for label, val := range want.labels {
+				Expect(got.labels).To(HaveKeyWithValue(label, val))
+			}
+			if direction == NodeToARM {
+				Expect(got.labels).NotTo(HaveKey("azure.tags/team"))
+			}
+			Expect(got.tags).To(Equal(want.tags))
+		},
+		syncTableEntries()...,
+	)
+})
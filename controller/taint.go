@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Tags whose names start with the taint tag prefix become node taints instead of labels. The rest
+// of the name is the taint key, with ':' standing for '/' as in tags made from labels, and the value
+// is the taint value and effect, e.g. tag "k8s-taint-dedicated" with value "gpu:NoSchedule" becomes
+// the taint "dedicated=gpu:NoSchedule". A value that is just an effect gives a taint without a value.
+const taintEffectSep string = ":"
+
+var taintEffects = []corev1.TaintEffect{corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute}
+
+// InvalidTaintTag is a tag under the taint tag prefix that doesn't describe a valid taint.
+type InvalidTaintTag struct {
+	TagName string
+	TagVal  string
+	Reason  string
+}
+
+// isTaintTag is true if the tag is to be turned into a taint.
+func isTaintTag(tagName string, configOptions ConfigOptions) bool {
+	return configOptions.TaintTagPrefix != "" && strings.HasPrefix(tagName, configOptions.TaintTagPrefix)
+}
+
+// tagToTaint returns the taint described by a tag under the taint tag prefix.
+func tagToTaint(tagName, tagVal string, configOptions ConfigOptions) (corev1.Taint, error) {
+	key := strings.Replace(strings.TrimPrefix(tagName, configOptions.TaintTagPrefix), labelSlashInTag, "/", -1)
+	if msgs := validation.IsQualifiedName(key); len(msgs) > 0 {
+		return corev1.Taint{}, fmt.Errorf("invalid taint key %q: %s", key, strings.Join(msgs, "; "))
+	}
+
+	value, effect := "", tagVal
+	if i := strings.LastIndex(tagVal, taintEffectSep); i >= 0 {
+		value, effect = tagVal[:i], tagVal[i+1:]
+	}
+	if msgs := validation.IsValidLabelValue(value); len(msgs) > 0 {
+		return corev1.Taint{}, fmt.Errorf("invalid taint value %q: %s", value, strings.Join(msgs, "; "))
+	}
+	for _, e := range taintEffects {
+		if effect == string(e) {
+			return corev1.Taint{Key: key, Value: value, Effect: e}, nil
+		}
+	}
+	return corev1.Taint{}, fmt.Errorf("invalid taint effect %q, must be one of %v", effect, taintEffects)
+}
+
+// taintID identifies a taint, since a node can have one taint for each key and effect.
+func taintID(taint corev1.Taint) string {
+	return taint.Key + taintEffectSep + string(taint.Effect)
+}
+
+// planTaints returns the node's taints with the desired ones applied, and which of them the controller
+// manages afterwards. A taint the controller didn't create is never changed or removed, even if a tag
+// asks for a different value; the tag is returned as a conflict instead. changed is false if the
+// taints stay as they are.
+func planTaints(current []corev1.Taint, managed map[string]bool, desired map[string]corev1.Taint, tagNames map[string]string) (
+	taints []corev1.Taint, newManaged map[string]bool, conflicts []Conflict, changed bool) {
+	taints = []corev1.Taint{}
+	newManaged = map[string]bool{}
+	seen := map[string]bool{}
+	for _, taint := range current {
+		id := taintID(taint)
+		want, ok := desired[id]
+		seen[id] = ok
+		switch {
+		case ok && managed[id]:
+			want.TimeAdded = taint.TimeAdded
+			taints = append(taints, want)
+			newManaged[id] = true
+		case ok:
+			if taint.Value != want.Value {
+				conflicts = append(conflicts, Conflict{
+					Direction: ARMToNode,
+					Target:    TaintTarget,
+					TagName:   tagNames[id],
+					TagVal:    want.Value + taintEffectSep + string(want.Effect),
+					LabelName: taint.Key,
+					LabelVal:  taint.Value + taintEffectSep + string(taint.Effect),
+				})
+			}
+			taints = append(taints, taint)
+		case managed[id]:
+			// the tag it came from is gone
+		default:
+			taints = append(taints, taint)
+		}
+	}
+
+	ids := make([]string, 0, len(desired))
+	for id := range desired {
+		if !seen[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		taints = append(taints, desired[id])
+		newManaged[id] = true
+	}
+
+	changed = len(taints) != len(current) || (len(taints) > 0 && !reflect.DeepEqual(taints, current))
+	return taints, newManaged, conflicts, changed
+}
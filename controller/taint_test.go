@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestTagToTaint(t *testing.T) {
+	options := DefaultConfigOptions()
+	options.TaintTagPrefix = "k8s-taint-"
+	tests := []struct {
+		tagName string
+		tagVal  string
+		want    corev1.Taint
+		wantErr bool
+	}{
+		{tagName: "k8s-taint-dedicated", tagVal: "gpu:NoSchedule", want: corev1.Taint{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}},
+		{tagName: "k8s-taint-example.com:spot", tagVal: "NoExecute", want: corev1.Taint{Key: "example.com/spot", Effect: corev1.TaintEffectNoExecute}},
+		{tagName: "k8s-taint-dedicated", tagVal: "gpu:NoSchedul", wantErr: true},
+		{tagName: "k8s-taint-dedicated", tagVal: "gpu", wantErr: true},
+		{tagName: "k8s-taint-dedicated", tagVal: "a b:NoSchedule", wantErr: true},
+		{tagName: "k8s-taint-", tagVal: "NoSchedule", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := tagToTaint(tt.tagName, tt.tagVal, options)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("tagToTaint(%q, %q) = %+v, %v, want %+v, error %v", tt.tagName, tt.tagVal, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestComputeSyncPlanTaints(t *testing.T) {
+	options := DefaultConfigOptions()
+	options.TaintTagPrefix = "k8s-taint-"
+	unreachable := corev1.Taint{Key: "node.kubernetes.io/unreachable", Effect: corev1.TaintEffectNoExecute}
+	state := SyncState{
+		Labels: map[string]string{},
+		Taints: []corev1.Taint{unreachable, {Key: "spot", Value: "true", Effect: corev1.TaintEffectNoSchedule}},
+		Tags: map[string]string{
+			"k8s-taint-dedicated": "gpu:NoSchedule",
+			"k8s-taint-spot":      "false:NoSchedule",
+			"k8s-taint-broken":    "Sometimes",
+			"env":                 "prod",
+		},
+	}
+
+	plan, err := ComputeSyncPlan(state, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dedicated := corev1.Taint{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}
+	// the spot taint wasn't created by the controller, so it's left alone
+	want := []corev1.Taint{unreachable, state.Taints[1], dedicated}
+	if !reflect.DeepEqual(plan.Taints, want) {
+		t.Errorf("Taints = %+v, want %+v", plan.Taints, want)
+	}
+	if len(plan.Conflicts) != 1 || plan.Conflicts[0].Target != TaintTarget || plan.Conflicts[0].TagName != "k8s-taint-spot" {
+		t.Errorf("Conflicts = %+v, want the spot taint", plan.Conflicts)
+	}
+	if len(plan.InvalidTaints) != 1 || plan.InvalidTaints[0].TagName != "k8s-taint-broken" {
+		t.Errorf("InvalidTaints = %+v", plan.InvalidTaints)
+	}
+	if !reflect.DeepEqual(plan.LabelsToAdd, map[string]string{"azure.tags/env": "prod"}) {
+		t.Errorf("LabelsToAdd = %v, want taint tags left out", plan.LabelsToAdd)
+	}
+	if !reflect.DeepEqual(plan.Managed.Taints, []string{"dedicated:NoSchedule"}) {
+		t.Errorf("Managed.Taints = %v", plan.Managed.Taints)
+	}
+
+	// unchanged taints aren't patched, and a managed taint goes once its tag is removed
+	state.Taints = plan.Taints
+	state.Managed = plan.Managed
+	if plan, err = ComputeSyncPlan(state, options); err != nil || plan.TaintsChanged() {
+		t.Errorf("ComputeSyncPlan() = %+v, %v, want taints unchanged", plan.Taints, err)
+	}
+	delete(state.Tags, "k8s-taint-dedicated")
+	plan, err = ComputeSyncPlan(state, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(plan.Taints, want[:2]) || plan.Managed.Taints != nil {
+		t.Errorf("Taints = %+v, Managed.Taints = %v, want the dedicated taint removed", plan.Taints, plan.Managed.Taints)
+	}
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	taglabelv1 "tag-label-sync.io/api/v1"
+)
+
+// configMapToNodes enqueues every node when the tag-label-sync ConfigMap changes, so new options
+// take effect without waiting for the sync period.
+func (r *ReconcileTagLabelSync) configMapToNodes(o handler.MapObject) []reconcile.Request {
+	if o.Meta.GetName() != ConfigMapName || o.Meta.GetNamespace() != ConfigMapNamespace {
+		return nil
+	}
+	return r.nodeRequests(labels.Everything())
+}
+
+// generationChangedPredicate ignores updates that don't change an object's generation, such as its
+// status being written, so recording a TagLabelSyncConfig's observed generation doesn't enqueue
+// every node it selects again.
+var generationChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.MetaOld == nil || e.MetaNew == nil {
+			return true
+		}
+		return e.MetaOld.GetGeneration() != e.MetaNew.GetGeneration()
+	},
+}
+
+// policyToNodes enqueues the nodes a TagLabelSyncConfig selects when it changes. Nodes it selected
+// before an update are enqueued too, since the handler maps both the old and the new object.
+func (r *ReconcileTagLabelSync) policyToNodes(o handler.MapObject) []reconcile.Request {
+	policy, ok := o.Object.(*taglabelv1.TagLabelSyncConfig)
+	if !ok {
+		return nil
+	}
+
+	var policies taglabelv1.TagLabelSyncConfigList
+	if err := r.List(context.Background(), &policies); err == nil && len(policies.Items) == 0 {
+		// the last one was deleted, so every node goes back to the ConfigMap
+		return r.nodeRequests(labels.Everything())
+	}
+
+	selector := labels.Everything()
+	if policy.Spec.NodeSelector != nil {
+		s, err := metav1.LabelSelectorAsSelector(policy.Spec.NodeSelector)
+		if err != nil {
+			// let the nodes report the invalid selector
+			return r.nodeRequests(labels.Everything())
+		}
+		selector = s
+	}
+	return r.nodeRequests(selector)
+}
+
+func (r *ReconcileTagLabelSync) nodeRequests(selector labels.Selector) []reconcile.Request {
+	var nodes corev1.NodeList
+	if err := r.List(context.Background(), &nodes); err != nil {
+		r.Log.Error(err, "failed to list nodes after a configuration change")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, node := range nodes.Items {
+		if selector.Matches(labels.Set(node.Labels)) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: node.Name}})
+		}
+	}
+	return requests
+}
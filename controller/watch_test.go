@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	taglabelv1 "tag-label-sync.io/api/v1"
+)
+
+func newTestReconciler(objs ...runtime.Object) *ReconcileTagLabelSync {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = taglabelv1.AddToScheme(scheme)
+	return &ReconcileTagLabelSync{
+		Client:   fake.NewFakeClientWithScheme(scheme, objs...),
+		Log:      ctrl.Log.WithName("test"),
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+	}
+}
+
+func TestPolicyToNodes(t *testing.T) {
+	gpu := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "gpu-0", Labels: map[string]string{"agentpool": "gpu"}}}
+	system := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "system-0", Labels: map[string]string{"agentpool": "system"}}}
+	policy := &taglabelv1.TagLabelSyncConfig{ObjectMeta: metav1.ObjectMeta{Name: "gpu"}}
+	policy.Spec.NodeSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"agentpool": "gpu"}}
+	r := newTestReconciler(gpu, system, policy)
+
+	got := r.policyToNodes(handler.MapObject{Meta: policy, Object: policy})
+	want := []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "gpu-0"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("policyToNodes() = %v, want %v", got, want)
+	}
+
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: ConfigMapNamespace}}
+	if got := r.configMapToNodes(handler.MapObject{Meta: configMap, Object: configMap}); len(got) != 2 {
+		t.Errorf("configMapToNodes() = %v, want both nodes", got)
+	}
+	other := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: ConfigMapNamespace}}
+	if got := r.configMapToNodes(handler.MapObject{Meta: other, Object: other}); len(got) != 0 {
+		t.Errorf("configMapToNodes() = %v, want no nodes for another ConfigMap", got)
+	}
+}
+
+func TestParseConfigOptionsCached(t *testing.T) {
+	r := newTestReconciler()
+	configMap := &corev1.ConfigMap{}
+	parsed := 0
+	parse := func() (ConfigOptions, error) {
+		parsed++
+		return ConfigOptions{}, errors.New("invalid")
+	}
+
+	for _, resourceVersion := range []string{"1", "1", "2"} {
+		if _, err := r.parseConfigOptions(r.Log, "ConfigMap/default/tag-label-sync", configMap, resourceVersion, parse); err == nil {
+			t.Errorf("expected the parse error to be returned")
+		}
+	}
+	if parsed != 2 {
+		t.Errorf("parsed %d times, want once per resource version", parsed)
+	}
+	if events := len(r.Recorder.(*record.FakeRecorder).Events); events != 2 {
+		t.Errorf("recorded %d events, want one per resource version", events)
+	}
+}
+
+func TestGenerationChangedPredicate(t *testing.T) {
+	old := &taglabelv1.TagLabelSyncConfig{ObjectMeta: metav1.ObjectMeta{Name: "gpu", Generation: 1}}
+	statusOnly := old.DeepCopy()
+	statusOnly.Status.ObservedGeneration = 1
+	if generationChangedPredicate.Update(event.UpdateEvent{MetaOld: old, ObjectOld: old, MetaNew: statusOnly, ObjectNew: statusOnly}) {
+		t.Errorf("a status update should be ignored")
+	}
+	specChanged := old.DeepCopy()
+	specChanged.Generation = 2
+	if !generationChangedPredicate.Update(event.UpdateEvent{MetaOld: old, ObjectOld: old, MetaNew: specChanged, ObjectNew: specChanged}) {
+		t.Errorf("a spec update should enqueue the nodes")
+	}
+	if !generationChangedPredicate.Delete(event.DeleteEvent{Meta: old, Object: old}) {
+		t.Errorf("a delete should enqueue the nodes")
+	}
+}
+
+func TestLoadConfigOptionsObservedGeneration(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "gpu-0"}}
+	policy := &taglabelv1.TagLabelSyncConfig{ObjectMeta: metav1.ObjectMeta{Name: "gpu", Generation: 3}}
+	r := newTestReconciler(node, policy)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, ok, err := r.loadConfigOptions(ctx, r.Log, node); !ok || err != nil {
+			t.Fatalf("loadConfigOptions() = %v, %v, want the config's options", ok, err)
+		}
+		var got taglabelv1.TagLabelSyncConfig
+		if err := r.Get(ctx, types.NamespacedName{Name: "gpu"}, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Status.ObservedGeneration != 3 {
+			t.Errorf("observedGeneration = %d, want 3", got.Status.ObservedGeneration)
+		}
+		if i == 0 {
+			policy = &got
+		} else if got.ResourceVersion != policy.ResourceVersion {
+			t.Errorf("status was written again although the generation is unchanged")
+		}
+	}
+}
+
+func TestLoadConfigOptionsPrunesDeletedConfigs(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "gpu-0"}}
+	gpu := &taglabelv1.TagLabelSyncConfig{ObjectMeta: metav1.ObjectMeta{Name: "gpu"}}
+	system := &taglabelv1.TagLabelSyncConfig{ObjectMeta: metav1.ObjectMeta{Name: "system"}}
+	r := newTestReconciler(node, gpu, system)
+	ctx := context.Background()
+	r.configCache.set(policyCacheKeyPrefix+"deleted", "1", ConfigOptions{}, nil)
+	r.configCache.set("ConfigMap/default/tag-label-sync", "1", ConfigOptions{}, nil)
+
+	if _, _, err := r.loadConfigOptions(ctx, r.Log, node); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.configCache.entries[policyCacheKeyPrefix+"deleted"]; ok {
+		t.Errorf("options of a deleted TagLabelSyncConfig are still cached")
+	}
+	if _, ok := r.configCache.entries["ConfigMap/default/tag-label-sync"]; !ok {
+		t.Errorf("options of the ConfigMap should stay cached")
+	}
+}
@@ -0,0 +1,27 @@
+package gce
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	defaultComputeEndpoint string = "https://compute.googleapis.com/compute/v1/"
+	computeScope           string = "https://www.googleapis.com/auth/compute"
+)
+
+// UserAgent is sent with every request.
+const UserAgent string = "tag-label-sync"
+
+// NewComputeClient returns an HTTP client for the Compute Engine API and its base URL. Credentials
+// are found the same way as gcloud does: from GOOGLE_APPLICATION_CREDENTIALS, the gcloud config or
+// the metadata server.
+func NewComputeClient(ctx context.Context) (*http.Client, string, error) {
+	client, err := google.DefaultClient(ctx, computeScope)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, defaultComputeEndpoint, nil
+}
@@ -0,0 +1,195 @@
+// Package gcetest is a stand-in for the parts of the Compute Engine API the controller uses, so it
+// can be tested without a Google Cloud project.
+package gcetest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"tag-label-sync.io/gce/instances"
+)
+
+// MaxLabels is the most labels a resource can have.
+const MaxLabels = 64
+
+var (
+	labelKeyRegexp   = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+	labelValueRegexp = regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+)
+
+// Instance is an instance's labels and network tags.
+type Instance struct {
+	Labels      map[string]string
+	NetworkTags []string
+}
+
+// Server answers Compute Engine instance requests from memory. Point the compute endpoint at URL.
+// Instances are found by name alone, whatever project and zone they're requested in.
+type Server struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// Instances are the instances, by name.
+	Instances map[string]*Instance
+	// Requests counts the requests for each method, e.g. "setLabels".
+	Requests map[string]int
+	// BeforeSetLabels, if set, is called with the instance before a setLabels request is checked,
+	// e.g. to change its labels as if someone else got there first.
+	BeforeSetLabels func(*Instance)
+
+	operations int
+}
+
+func NewServer() *Server {
+	s := &Server{
+		Instances: map[string]*Instance{},
+		Requests:  map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Endpoint is the base URL of the API.
+func (s *Server) Endpoint() string {
+	return s.URL + "/compute/v1/"
+}
+
+// InstanceClients returns an instances.ClientFactory of clients that call s without credentials.
+func (s *Server) InstanceClients() instances.ClientFactory {
+	return func(ctx context.Context, project, zone string) (*instances.Client, error) {
+		return instances.NewClientService(project, zone, instances.NewService(s.Client(), s.Endpoint())), nil
+	}
+}
+
+// InstanceLabels returns a copy of an instance's labels.
+func (s *Server) InstanceLabels(name string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	labels := map[string]string{}
+	if instance, ok := s.Instances[name]; ok {
+		for k, v := range instance.Labels {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// Fingerprint returns the fingerprint of a set of labels, which changes whenever they do.
+func Fingerprint(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, labels[k])
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)[:8])
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// compute/v1/projects/{project}/zones/{zone}/{collection}/{name}[/{method}]
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/compute/v1/"), "/")
+	if len(parts) < 6 || parts[0] != "projects" || parts[2] != "zones" {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("The requested URL %s was not found.", r.URL.Path))
+		return
+	}
+	collection, name, method := parts[4], parts[5], r.Method
+	if len(parts) == 7 {
+		method = parts[6]
+	}
+	s.Requests[method]++
+
+	switch {
+	case collection == "instances" && method == http.MethodGet:
+		s.getInstance(w, name)
+	case collection == "instances" && method == "setLabels" && r.Method == http.MethodPost:
+		s.setLabels(w, r, name)
+	case collection == "operations" && method == "wait" && r.Method == http.MethodPost:
+		// operations finish as soon as they're waited on
+		writeJSON(w, map[string]string{"name": name, "status": "DONE"})
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("The requested URL %s was not found.", r.URL.Path))
+	}
+}
+
+func (s *Server) getInstance(w http.ResponseWriter, name string) {
+	instance, ok := s.Instances[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("The resource 'instances/%s' was not found", name))
+		return
+	}
+	result := map[string]interface{}{
+		"name":             name,
+		"labels":           instance.Labels,
+		"labelFingerprint": Fingerprint(instance.Labels),
+	}
+	if len(instance.NetworkTags) > 0 {
+		result["tags"] = map[string]interface{}{"items": instance.NetworkTags}
+	}
+	writeJSON(w, result)
+}
+
+func (s *Server) setLabels(w http.ResponseWriter, r *http.Request, name string) {
+	instance, ok := s.Instances[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("The resource 'instances/%s' was not found", name))
+		return
+	}
+	var req struct {
+		Labels           map[string]string `json:"labels"`
+		LabelFingerprint string            `json:"labelFingerprint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if s.BeforeSetLabels != nil {
+		s.BeforeSetLabels(instance)
+	}
+	if req.LabelFingerprint != Fingerprint(instance.Labels) {
+		writeError(w, http.StatusPreconditionFailed, "Labels fingerprint either invalid or resource labels have changed")
+		return
+	}
+	if len(req.Labels) > MaxLabels {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Resource has more than %d labels", MaxLabels))
+		return
+	}
+	for k, v := range req.Labels {
+		if !labelKeyRegexp.MatchString(k) || !labelValueRegexp.MatchString(v) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid label %s=%s", k, v))
+			return
+		}
+	}
+	instance.Labels = req.Labels
+
+	// the change is made right away, but the operation is only done once it's waited on
+	s.operations++
+	writeJSON(w, map[string]string{"name": fmt.Sprintf("operation-%d", s.operations), "status": "RUNNING"})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": status, "message": message},
+	})
+}
@@ -0,0 +1,88 @@
+package instances
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type Service interface {
+	Get(context.Context, string, string, string) (Instance, error)
+	SetLabels(context.Context, string, string, string, SetLabelsRequest) (Operation, error)
+	WaitOperation(context.Context, string, string, string) (Operation, error)
+}
+
+// ClientFactory is used to inject the client as dependency into the reconciler
+type ClientFactory func(context.Context, string, string) (*Client, error)
+
+// NewCachedClientFactory returns a ClientFactory that keeps one client per project and zone, all
+// sharing one HTTP client, so credentials are only looked up once.
+func NewCachedClientFactory() ClientFactory {
+	var mu sync.Mutex
+	var service Service
+	clients := map[string]*Client{}
+	return func(ctx context.Context, project, zone string) (*Client, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := project + "/" + zone
+		if c, ok := clients[key]; ok {
+			return c, nil
+		}
+		if service == nil {
+			// the HTTP client outlives this reconcile, so its token source can't use the reconcile's context
+			c, err := newClient(context.Background())
+			if err != nil {
+				return nil, err
+			}
+			service = c
+		}
+		clients[key] = NewClientService(project, zone, service)
+		return clients[key], nil
+	}
+}
+
+// Client reads and writes the labels of Compute Engine instances in a zone
+type Client struct {
+	project  string
+	zone     string
+	internal Service
+}
+
+func NewClientService(project, zone string, internal Service) *Client {
+	return &Client{project: project, zone: zone, internal: internal}
+}
+
+func NewClient(ctx context.Context, project, zone string) (*Client, error) {
+	c, err := newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{project: project, zone: zone, internal: c}, nil
+}
+
+func (c *Client) Get(ctx context.Context, name string) (*Instance, error) {
+	instance, err := c.internal.Get(ctx, c.project, c.zone, name)
+	if err != nil {
+		return nil, err
+	}
+	return &instance, nil
+}
+
+// SetLabels replaces the labels of an instance and waits for it to finish. It fails if the labels
+// no longer have the given fingerprint.
+func (c *Client) SetLabels(ctx context.Context, name string, labels map[string]string, fingerprint string) error {
+	op, err := c.internal.SetLabels(ctx, c.project, c.zone, name, SetLabelsRequest{Labels: labels, LabelFingerprint: fingerprint})
+	if err != nil {
+		return err
+	}
+	for op.Status != operationDone {
+		if op, err = c.internal.WaitOperation(ctx, c.project, c.zone, op.Name); err != nil {
+			return err
+		}
+	}
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		return fmt.Errorf("operation %s failed: %s: %s", op.Name, op.Error.Errors[0].Code, op.Error.Errors[0].Message)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package instances
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"tag-label-sync.io/gce"
+)
+
+// Error is an error response from the Compute Engine API.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("compute API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// IsPreconditionFailed is true if a request was rejected because the fingerprint it was given is out
+// of date, i.e. the resource changed since it was read.
+func IsPreconditionFailed(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusPreconditionFailed
+}
+
+type client struct {
+	http    *http.Client
+	baseURL string
+}
+
+// NewService returns a Service that calls the API at baseURL with an HTTP client that was set up
+// elsewhere, e.g. for a local stand-in.
+func NewService(httpClient *http.Client, baseURL string) Service {
+	return &client{http: httpClient, baseURL: strings.TrimSuffix(baseURL, "/") + "/"}
+}
+
+func newClient(ctx context.Context) (*client, error) {
+	c, baseURL, err := gce.NewComputeClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &client{http: c, baseURL: baseURL}, nil
+}
+
+func (c *client) Get(ctx context.Context, project, zone, name string) (Instance, error) {
+	var instance Instance
+	err := c.do(ctx, http.MethodGet, instancePath(project, zone, name), nil, &instance)
+	return instance, err
+}
+
+func (c *client) SetLabels(ctx context.Context, project, zone, name string, labels SetLabelsRequest) (Operation, error) {
+	var op Operation
+	err := c.do(ctx, http.MethodPost, instancePath(project, zone, name)+"/setLabels", labels, &op)
+	return op, err
+}
+
+func (c *client) WaitOperation(ctx context.Context, project, zone, name string) (Operation, error) {
+	var op Operation
+	path := fmt.Sprintf("projects/%s/zones/%s/operations/%s/wait", url.PathEscape(project), url.PathEscape(zone), url.PathEscape(name))
+	err := c.do(ctx, http.MethodPost, path, nil, &op)
+	return op, err
+}
+
+func instancePath(project, zone, name string) string {
+	return fmt.Sprintf("projects/%s/zones/%s/instances/%s", url.PathEscape(project), url.PathEscape(zone), url.PathEscape(name))
+}
+
+func (c *client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", gce.UserAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		message := string(data)
+		if json.Unmarshal(data, &errResp) == nil && errResp.Error.Message != "" {
+			message = errResp.Error.Message
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: message}
+	}
+	return json.Unmarshal(data, result)
+}
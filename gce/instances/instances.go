@@ -0,0 +1,39 @@
+package instances
+
+// Instance is the part of a Compute Engine instance that has its labels and network tags.
+type Instance struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// LabelFingerprint is the fingerprint of the labels, which setLabels has to be given so that
+	// labels changed by someone else in the meantime aren't overwritten.
+	LabelFingerprint string       `json:"labelFingerprint"`
+	Tags             *NetworkTags `json:"tags,omitempty"`
+}
+
+// NetworkTags are the network tags of an instance, used by firewall rules and routes.
+type NetworkTags struct {
+	Items       []string `json:"items,omitempty"`
+	Fingerprint string   `json:"fingerprint,omitempty"`
+}
+
+// SetLabelsRequest replaces all the labels of an instance.
+type SetLabelsRequest struct {
+	Labels           map[string]string `json:"labels"`
+	LabelFingerprint string            `json:"labelFingerprint"`
+}
+
+// Operation is a long-running operation on a zonal resource.
+type Operation struct {
+	Name   string          `json:"name"`
+	Status string          `json:"status"`
+	Error  *OperationError `json:"error,omitempty"`
+}
+
+const operationDone string = "DONE"
+
+type OperationError struct {
+	Errors []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
@@ -0,0 +1,32 @@
+// example: gce://my-project/us-central1-a/gke-cluster-default-pool-1234abcd-x9z8
+
+package gce
+
+import (
+	"fmt"
+	"strings"
+)
+
+const providerIDPrefix string = "gce://"
+
+type Instance struct {
+	Project string
+	Zone    string
+	Name    string
+}
+
+func ParseProviderID(providerID string) (Instance, error) {
+	if !strings.HasPrefix(providerID, providerIDPrefix) {
+		return Instance{}, fmt.Errorf("parsing failed for %s. Invalid provider ID format", providerID)
+	}
+	segments := strings.Split(strings.TrimPrefix(providerID, providerIDPrefix), "/")
+	if len(segments) != 3 {
+		return Instance{}, fmt.Errorf("parsing failed for %s. Invalid provider ID format", providerID)
+	}
+	for _, segment := range segments {
+		if segment == "" {
+			return Instance{}, fmt.Errorf("parsing failed for %s. Invalid provider ID format", providerID)
+		}
+	}
+	return Instance{Project: segments[0], Zone: segments[1], Name: segments[2]}, nil
+}
@@ -0,0 +1,53 @@
+package gce
+
+import (
+	"testing"
+)
+
+func TestParseProviderID(t *testing.T) {
+	var tests = []struct {
+		name       string
+		providerID string
+		expected   Instance
+		wantErr    bool
+	}{
+		{
+			name:       "instance",
+			providerID: "gce://my-project/us-central1-a/gke-cluster-default-pool-1234abcd-x9z8",
+			expected:   Instance{Project: "my-project", Zone: "us-central1-a", Name: "gke-cluster-default-pool-1234abcd-x9z8"},
+		},
+		{
+			name:       "missing zone",
+			providerID: "gce://my-project/instance-1",
+			wantErr:    true,
+		},
+		{
+			name:       "empty project",
+			providerID: "gce:///us-central1-a/instance-1",
+			wantErr:    true,
+		},
+		{
+			name:       "other scheme",
+			providerID: "aws:///us-west-2a/i-0123456789abcdef0",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance, err := ParseProviderID(tt.providerID)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error for %s", tt.providerID)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if instance != tt.expected {
+				t.Errorf("got %+v, want %+v", instance, tt.expected)
+			}
+		})
+	}
+}
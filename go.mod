@@ -9,11 +9,14 @@ require (
 	github.com/Azure/go-autorest/autorest/azure/auth v0.2.0
 	github.com/Azure/go-autorest/autorest/to v0.2.0
 	github.com/Azure/go-autorest/autorest/validation v0.1.0 // indirect
+	github.com/aws/aws-sdk-go v1.25.0
 	github.com/go-logr/logr v0.1.0
 	github.com/juju/errors v0.0.0-20190806202954-0232dcc7464d
 	github.com/onsi/ginkgo v1.8.0
 	github.com/onsi/gomega v1.5.0
+	github.com/prometheus/client_golang v0.9.0
 	github.com/satori/go.uuid v1.2.0
+	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
 	k8s.io/api v0.0.0-20190409021203-6e4e0e4f393b
 	k8s.io/apimachinery v0.0.0-20190404173353-6a84e37a896d
 	k8s.io/client-go v11.0.1-0.20190409021438-1a26190bd76a+incompatible
@@ -26,6 +26,7 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	taglabelv1 "tag-label-sync.io/api/v1"
 	"tag-label-sync.io/controller"
 	// +kubebuilder:scaffold:imports
 )
@@ -39,6 +40,7 @@ func init() {
 	_ = clientgoscheme.AddToScheme(scheme)
 
 	_ = appsv1.AddToScheme(scheme)
+	_ = taglabelv1.AddToScheme(scheme)
 	// +kubebuilder:scaffold:scheme
 }
 
@@ -46,10 +48,13 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var syncPeriod string
+	var enableWebhooks bool
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&syncPeriod, "sync-period", "10h", "Min frequency that tags and nodes are reconciled. Give time as integer with suffixes ns, us, ms, s, m, or h. Ex: \"100ns\" or \"2h30m\". Default is \"10h\".")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve admission webhooks for TagLabelSyncConfig. Requires a serving certificate, see config/certmanager.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.Logger(true))
@@ -76,11 +81,19 @@ func main() {
 		Log:      ctrl.Log.WithName("controllers"),
 		Scheme:   mgr.GetScheme(),
 		Recorder: mgr.GetEventRecorderFor("tag-label-sync"),
+		// clients are shared between nodes rather than authorized again on every reconcile
+		AzureClients: controller.CachedAzureClients(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller")
 		os.Exit(1)
 	}
 	setupLog.Info("successfully registered controller")
+	if enableWebhooks {
+		if err = (&taglabelv1.TagLabelSyncConfig{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "TagLabelSyncConfig")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")